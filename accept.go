@@ -0,0 +1,133 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AcceptsMediaType parses an Accept header as described in RFC 7231, and
+// reports whether mediaType, for example "application/json", is acceptable,
+// along with its quality value. The quality is taken from the most specific
+// media range that matches: "text/html;level=1" beats "text/html", which
+// beats "text/*", which beats "*/*". A range with parameters only matches a
+// mediaType with the same parameters, like "text/html; level=1". Ranges are
+// compared case insensitively. A missing q parameter counts as 1, and an
+// invalid one as 0. An empty header accepts everything.
+//
+// Every feature in this package that looks at the Accept header uses
+// AcceptsMediaType, so they all agree on what a client accepts.
+func AcceptsMediaType(header, mediaType string) (bool, float64) {
+	if strings.TrimSpace(header) == "" {
+		return true, 1
+	}
+	mparams := strings.Split(strings.ToLower(mediaType), ";")
+	mediaType = strings.TrimSpace(mparams[0])
+	want := make(map[string]string)
+	for _, param := range mparams[1:] {
+		if kv := strings.SplitN(strings.TrimSpace(param), "=", 2); len(kv) == 2 {
+			want[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+	}
+	typ, subtype := mediaType, ""
+	if i := strings.Index(mediaType, "/"); i >= 0 {
+		typ, subtype = mediaType[:i], mediaType[i+1:]
+	}
+	best := -1
+	q := 0.0
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		rng := strings.ToLower(strings.TrimSpace(params[0]))
+		if rng == "" {
+			continue
+		}
+		rtyp, rsubtype := rng, ""
+		if i := strings.Index(rng, "/"); i >= 0 {
+			rtyp, rsubtype = rng[:i], rng[i+1:]
+		}
+		var specificity int
+		switch {
+		case rtyp == typ && rsubtype == subtype:
+			specificity = 2
+		case rtyp == typ && rsubtype == "*":
+			specificity = 1
+		case rtyp == "*" && rsubtype == "*":
+			specificity = 0
+		default:
+			continue
+		}
+		// Parameters before q are part of the media range; the ones after
+		// it are accept extensions, which are ignored.
+		rangeQ := 1.0
+		matches := true
+		hasParams := false
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			if key == "q" {
+				f, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+				if err != nil || f < 0 {
+					f = 0
+				} else if f > 1 {
+					f = 1
+				}
+				rangeQ = f
+				break
+			}
+			hasParams = true
+			if want[key] != strings.ToLower(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+		if hasParams {
+			specificity = 3
+		}
+		if specificity <= best {
+			continue
+		}
+		best = specificity
+		q = rangeQ
+	}
+	if best < 0 {
+		return false, 0
+	}
+	return q > 0, q
+}
+
+// prefersHTML reports whether the client would rather have text/html than
+// application/json, for example a browser.
+func prefersHTML(r *http.Request) bool {
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return false
+	}
+	htmlOK, htmlQ := AcceptsMediaType(header, "text/html")
+	_, jsonQ := AcceptsMediaType(header, "application/json")
+	return htmlOK && htmlQ > jsonQ
+}
+
+// RequireJSONAcceptMiddleware returns a 406 error if the client's Accept
+// header does not allow an application/json response. Requests with no
+// Accept header, or one that accepts */* or application/*, are passed
+// through to h.
+func RequireJSONAcceptMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, _ := AcceptsMediaType(r.Header.Get("Accept"), "application/json"); !ok {
+			WriteError(w, &Error{
+				Title:      "Not acceptable",
+				Id:         "not_acceptable",
+				Detail:     "This endpoint can only return application/json responses",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusNotAcceptable,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
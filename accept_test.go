@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+var acceptTests = []struct {
+	header string
+	ok     bool
+	q      float64
+}{
+	{"", true, 1},
+	{"application/json", true, 1},
+	{"*/*", true, 1},
+	{"application/*;q=0.5", true, 0.5},
+	{"text/html", false, 0},
+	{"text/html, application/json;q=0.8", true, 0.8},
+	{"application/json;q=0, */*", false, 0},
+	{"*/*;q=0.1, application/json;q=0.9", true, 0.9},
+}
+
+func TestAcceptsMediaType(t *testing.T) {
+	for _, tt := range acceptTests {
+		ok, q := AcceptsMediaType(tt.header, "application/json")
+		if ok != tt.ok || q != tt.q {
+			t.Errorf("AcceptsMediaType(%q): got (%t, %v), want (%t, %v)", tt.header, ok, q, tt.ok, tt.q)
+		}
+	}
+}
+
+func TestAcceptsMediaTypeParams(t *testing.T) {
+	for _, tt := range []struct {
+		header    string
+		mediaType string
+		ok        bool
+		q         float64
+	}{
+		{"APPLICATION/JSON", "application/json", true, 1},
+		{"text/html;level=1, text/html;q=0.5", "text/html; level=1", true, 1},
+		{"text/html;level=1, text/html;q=0.5", "text/html", true, 0.5},
+		{"text/html;level=1", "text/html", false, 0},
+		{"text/*;q=0.3, text/csv;q=0.7", "text/csv; charset=utf-8", true, 0.7},
+		{"text/csv;q=0.7;ext=1", "text/csv", true, 0.7},
+		{"text/csv;q=abc", "text/csv", false, 0},
+		{"application/json", "text/csv", false, 0},
+	} {
+		ok, q := AcceptsMediaType(tt.header, tt.mediaType)
+		if ok != tt.ok || q != tt.q {
+			t.Errorf("AcceptsMediaType(%q, %q): got (%t, %v), want (%t, %v)", tt.header, tt.mediaType, ok, q, tt.ok, tt.q)
+		}
+	}
+}
+
+func TestRequireJSONAccept(t *testing.T) {
+	h := RequireJSONAcceptMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1", nil)
+	req.Header.Set("Accept", "text/html")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotAcceptable)
+	test.AssertContains(t, w.Body.String(), "not_acceptable")
+
+	w = httptest.NewRecorder()
+	req.Header.Set("Accept", "text/html, */*;q=0.1")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func newForbidden(r *http.Request) *Error {
+	return &Error{
+		Title:      "Forbidden",
+		Id:         "forbidden",
+		Instance:   r.URL.Path,
+		StatusCode: http.StatusForbidden,
+	}
+}
+
+// SharedSecretMiddleware returns a 403 error unless the request's header
+// (for example "X-Internal-Token") is equal to secret. The values are
+// compared in constant time, so the response time doesn't reveal how much of
+// the secret a client guessed correctly.
+func SharedSecretMiddleware(h http.Handler, header, secret string) http.Handler {
+	// Comparing hashes means the comparison doesn't leak the secret's length
+	// either.
+	want := sha256.Sum256([]byte(secret))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get(header)
+		gotSum := sha256.Sum256([]byte(got))
+		if got == "" || subtle.ConstantTimeCompare(gotSum[:], want[:]) != 1 {
+			WriteError(w, newForbidden(r))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// SignatureEncoding is the encoding of the signature header checked by
+// HMACVerifyMiddleware.
+type SignatureEncoding int
+
+const (
+	// HexSignature signatures are hex encoded, like GitHub's.
+	HexSignature SignatureEncoding = iota
+	// Base64Signature signatures use standard base64 encoding, like
+	// Twilio's and Shopify's.
+	Base64Signature
+)
+
+func (e SignatureEncoding) decode(s string) ([]byte, error) {
+	if e == Base64Signature {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return hex.DecodeString(s)
+}
+
+// HMACVerifyMiddleware returns a 401 error unless header contains a hex
+// encoded HMAC-SHA256 signature of the request body, computed with secret.
+// A "sha256=" prefix on the signature is ignored. After checking the
+// signature, the body is restored so h can read it.
+//
+// The body is read into memory before the signature is checked, so bodies
+// larger than MaxBufferedBodyBytes are rejected with a 413 error.
+func HMACVerifyMiddleware(h http.Handler, secret []byte, header string) http.Handler {
+	return HMACVerifyMiddlewareWithEncoding(h, secret, header, HexSignature)
+}
+
+// HMACVerifyMiddlewareWithEncoding is like HMACVerifyMiddleware, for
+// signatures in the given encoding.
+func HMACVerifyMiddlewareWithEncoding(h http.Handler, secret []byte, header string, enc SignatureEncoding) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBody(w, r, MaxBufferedBodyBytes)
+		if !ok {
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sig := strings.TrimPrefix(r.Header.Get(header), "sha256=")
+		got, err := enc.decode(sig)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if sig == "" || err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+			WriteError(w, &Error{
+				Title:      "Invalid signature",
+				Id:         "invalid_signature",
+				Detail:     "The request signature in the " + header + " header is missing or incorrect",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusUnauthorized,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RequireSubjectMiddleware returns a 401 error for requests with one of the
+// given methods (WriteMethods and DELETE if none are given) unless subject
+// returns a non-empty string for the request. subject usually reads the
+// authenticated user or API key an earlier authentication middleware stored
+// in the request context:
+//
+//	h = server.RequireSubjectMiddleware(h, func(r *http.Request) string {
+//		return auth.UserID(r.Context())
+//	})
+//
+// Place it inside the authentication middleware, as a backstop for write
+// routes that were accidentally registered without requiring authentication.
+// Requests with other methods are passed to h without being checked.
+func RequireSubjectMiddleware(h http.Handler, subject func(*http.Request) string, methods ...string) http.Handler {
+	if len(methods) == 0 {
+		methods = append(WriteMethods(), "DELETE")
+	}
+	check := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		check[strings.ToUpper(m)] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check[strings.ToUpper(r.Method)] && subject(r) == "" {
+			WriteError(w, &Error{
+				Title:      "Unauthorized",
+				Id:         "unauthorized",
+				Detail:     "This request requires authentication",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusUnauthorized,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestSharedSecret(t *testing.T) {
+	h := SharedSecretMiddleware(okHandler, "X-Internal-Token", "s3cret")
+	for _, token := range []string{"", "s3cre", "s3cret1", "wrong!"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/internal", nil)
+		if token != "" {
+			req.Header.Set("X-Internal-Token", token)
+		}
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusForbidden)
+		test.AssertContains(t, w.Body.String(), "forbidden")
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/internal", nil)
+	req.Header.Set("X-Internal-Token", "s3cret")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func sign(secret, body string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
+
+func TestHMACVerify(t *testing.T) {
+	body := `{"event": "job.created"}`
+	var got string
+	h := HMACVerifyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}), []byte("s3cret"), "X-Signature")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(body))
+	req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(sign("s3cret", body)))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, got, body)
+
+	for _, sig := range []string{"", "nothex", hex.EncodeToString(sign("wrong", body))} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/webhooks", strings.NewReader(body))
+		req.Header.Set("X-Signature", sig)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusUnauthorized)
+		test.AssertContains(t, w.Body.String(), "invalid_signature")
+	}
+}
+
+func TestHMACVerifyBase64(t *testing.T) {
+	body := `{"event": "job.created"}`
+	h := HMACVerifyMiddlewareWithEncoding(okHandler, []byte("s3cret"), "X-Signature", Base64Signature)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(body))
+	req.Header.Set("X-Signature", base64.StdEncoding.EncodeToString(sign("s3cret", body)))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+type subjectKey struct{}
+
+func TestRequireSubject(t *testing.T) {
+	subject := func(r *http.Request) string {
+		s, _ := r.Context().Value(subjectKey{}).(string)
+		return s
+	}
+	for _, tt := range []struct {
+		methods []string
+		method  string
+		subject string
+		code    int
+	}{
+		{nil, "POST", "", http.StatusUnauthorized},
+		{nil, "DELETE", "", http.StatusUnauthorized},
+		{nil, "delete", "", http.StatusUnauthorized},
+		{nil, "POST", "usr_123", http.StatusOK},
+		{nil, "GET", "", http.StatusOK},
+		{[]string{"get"}, "GET", "", http.StatusUnauthorized},
+		{[]string{"GET"}, "POST", "", http.StatusOK},
+	} {
+		h := RequireSubjectMiddleware(okHandler, subject, tt.methods...)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, "/v1/jobs", nil)
+		if tt.subject != "" {
+			req = req.WithContext(context.WithValue(req.Context(), subjectKey{}, tt.subject))
+		}
+		h.ServeHTTP(w, req)
+		if tt.code == http.StatusOK {
+			test.AssertEquals(t, w.Code, http.StatusOK)
+		} else {
+			test.AssertErrorResponse(t, w, tt.code, "unauthorized")
+		}
+	}
+}
+
+func TestHMACVerifyBodyTooLarge(t *testing.T) {
+	h := HMACVerifyMiddleware(okHandler, []byte("s3cret"), "X-Signature")
+	body := strings.Repeat("a", MaxBufferedBodyBytes+1)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(body))
+	req.Header.Set("X-Signature", hex.EncodeToString(sign("s3cret", body)))
+	h.ServeHTTP(w, req)
+	test.AssertErrorResponse(t, w, http.StatusRequestEntityTooLarge, "request_too_large")
+}
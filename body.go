@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MaxBufferedBodyBytes is the largest request body that middleware which
+// reads the whole body into memory before calling the next handler, like
+// HMACVerifyMiddleware, will accept. Larger bodies get a 413 error.
+const MaxBufferedBodyBytes = 10 << 20
+
+func newRequestTooLarge(r *http.Request, limit int64) *Error {
+	return &Error{
+		Title:      "Request body too large",
+		Id:         "request_too_large",
+		Detail:     fmt.Sprintf("The request body must be at most %d bytes", limit),
+		Instance:   r.URL.Path,
+		StatusCode: http.StatusRequestEntityTooLarge,
+	}
+}
+
+// readBody reads and closes r's body, up to limit bytes. If the body is too
+// large or can't be read, it writes an error to w and returns false.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	if r.ContentLength > limit {
+		WriteError(w, newRequestTooLarge(r, limit))
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	r.Body.Close()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, newRequestTooLarge(r, tooLarge.Limit))
+			return nil, false
+		}
+		WriteError(w, &Error{
+			Title:      "Could not read request body",
+			Id:         "invalid_body",
+			Detail:     err.Error(),
+			Instance:   r.URL.Path,
+			StatusCode: http.StatusBadRequest,
+		})
+		return nil, false
+	}
+	return body, true
+}
+
+// RejectBodyMiddleware returns a 400 error for requests that use one of the
+// given methods and include a request body. If no methods are given, GET,
+// HEAD and DELETE requests are checked.
+//
+// A request has a body if its Content-Length is greater than zero, or if the
+// length is unknown (for chunked requests) and at least one byte can be read
+// from the body.
+func RejectBodyMiddleware(h http.Handler, methods ...string) http.Handler {
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD", "DELETE"}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checked := false
+		for _, method := range methods {
+			if strings.EqualFold(method, r.Method) {
+				checked = true
+				break
+			}
+		}
+		if checked && hasBody(r) {
+			WriteError(w, &Error{
+				Title:      "Unexpected request body",
+				Id:         "unexpected_body",
+				Detail:     r.Method + " requests must not include a request body",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func hasBody(r *http.Request) bool {
+	if r.ContentLength > 0 {
+		return true
+	}
+	if r.ContentLength == 0 || r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+	var b [1]byte
+	n, _ := io.ReadFull(r.Body, b[:])
+	return n > 0
+}
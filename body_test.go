@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+func TestRejectBody(t *testing.T) {
+	h := RejectBodyMiddleware(okHandler)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", strings.NewReader("{}"))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "unexpected_body")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/jobs", strings.NewReader("{}"))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestRejectBodyUnknownLength(t *testing.T) {
+	h := RejectBodyMiddleware(okHandler, "GET")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", io.NopCloser(strings.NewReader("{}")))
+	req.ContentLength = -1
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/jobs", io.NopCloser(strings.NewReader("")))
+	req.ContentLength = -1
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestReadBody(t *testing.T) {
+	for _, tt := range []struct {
+		body          string
+		contentLength bool
+		ok            bool
+	}{
+		{"hello", true, true},
+		{"hello", false, true},
+		{"hello world", true, false},
+		{"hello world", false, false},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(tt.body))
+		if !tt.contentLength {
+			req.ContentLength = -1
+		}
+		body, ok := readBody(w, req, 10)
+		test.AssertEquals(t, ok, tt.ok)
+		if tt.ok {
+			test.AssertEquals(t, string(body), tt.body)
+		} else {
+			test.AssertErrorResponse(t, w, http.StatusRequestEntityTooLarge, "request_too_large")
+		}
+	}
+}
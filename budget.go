@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BudgetHeader is the request header BudgetMiddleware reads the time budget
+// from, in milliseconds.
+const BudgetHeader = "X-Time-Budget-Ms"
+
+// maxBudgetMs is the largest budget, in milliseconds, that fits in a
+// time.Duration.
+const maxBudgetMs = math.MaxInt64 / int64(time.Millisecond)
+
+// BudgetMiddleware enforces the time budget a caller sends in the
+// X-Time-Budget-Ms header: the number of milliseconds the caller is willing
+// to wait for a response, across every service the request passes through.
+// The request's context gets a deadline when the budget runs out, so work
+// started with the context is canceled, and handlers can call
+// RemainingBudget to pass what's left to the services they call.
+//
+// A request whose budget is zero or negative gets a 504 error right away.
+// Requests without the header, or with a header that isn't an integer, are
+// passed to h without a budget.
+func BudgetMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hdr := strings.TrimSpace(r.Header.Get(BudgetHeader))
+		if hdr == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ms, err := strconv.ParseInt(hdr, 10, 64)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if ms <= 0 {
+			WriteError(w, &Error{
+				Title:      "Time budget exhausted",
+				Id:         "budget_exhausted",
+				Detail:     "The request's time budget ran out before it reached this server",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusGatewayTimeout,
+			})
+			return
+		}
+		// Clamp huge budgets, which would overflow a time.Duration and
+		// give a deadline in the past.
+		if ms > maxBudgetMs {
+			ms = maxBudgetMs
+		}
+		deadline := time.Now().Add(time.Duration(ms) * time.Millisecond)
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		ctx = context.WithValue(ctx, budgetKey, deadline)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RemainingBudget returns how much of the request's time budget is left, to
+// send to downstream services in the X-Time-Budget-Ms header:
+//
+//	if left := server.RemainingBudget(r); left > 0 {
+//		req.Header.Set(server.BudgetHeader, strconv.FormatInt(left.Milliseconds(), 10))
+//	}
+//
+// It returns 0 if the budget has run out, or if the request wasn't sent with
+// a budget, in which case the header shouldn't be sent either.
+func RemainingBudget(r *http.Request) time.Duration {
+	deadline, ok := r.Context().Value(budgetKey).(time.Time)
+	if !ok {
+		return 0
+	}
+	if left := time.Until(deadline); left > 0 {
+		return left
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestBudgetMiddleware(t *testing.T) {
+	var left time.Duration
+	var deadline time.Time
+	var hasDeadline bool
+	h := BudgetMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		left = RemainingBudget(r)
+		deadline, hasDeadline = r.Context().Deadline()
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	req.Header.Set(BudgetHeader, "500")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.Assert(t, left > 400*time.Millisecond && left <= 500*time.Millisecond, "unexpected remaining budget "+left.String())
+	test.Assert(t, hasDeadline, "expected a context deadline")
+	test.Assert(t, time.Until(deadline) <= 500*time.Millisecond, "expected deadline within the budget")
+
+	for _, hdr := range []string{"9223372036854775807", "9223372036854775"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/v1/jobs", nil)
+		req.Header.Set(BudgetHeader, hdr)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+		test.Assert(t, left > 100*365*24*time.Hour, "expected a huge budget to be clamped, got "+left.String())
+		test.Assert(t, hasDeadline && time.Until(deadline) > 0, "expected a deadline in the future")
+	}
+
+	for _, hdr := range []string{"", "abc"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/v1/jobs", nil)
+		req.Header.Set(BudgetHeader, hdr)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+		test.AssertEquals(t, left, time.Duration(0))
+		test.Assert(t, !hasDeadline, "expected no deadline without a budget")
+	}
+}
+
+func TestBudgetExhausted(t *testing.T) {
+	h := BudgetMiddleware(okHandler)
+	for _, hdr := range []string{"0", "-20"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+		req.Header.Set(BudgetHeader, hdr)
+		h.ServeHTTP(w, req)
+		test.AssertErrorResponse(t, w, http.StatusGatewayTimeout, "budget_exhausted")
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+)
+
+// bufferWriter holds the status and body of a response in memory, until
+// either the handler returns or the body grows past max bytes.
+type bufferWriter struct {
+	http.ResponseWriter
+	max       int
+	status    int
+	buf       bytes.Buffer
+	streaming bool
+	// head is true for HEAD requests, whose handlers may not write the
+	// body, so its length isn't known.
+	head bool
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+	if w.streaming {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.buf.Len()+len(b) <= w.max {
+		return w.buf.Write(b)
+	}
+	if err := w.startStreaming(); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// startStreaming sends the status and anything buffered so far to the
+// client, and stops buffering.
+func (w *bufferWriter) startStreaming() error {
+	if w.streaming {
+		return nil
+	}
+	w.streaming = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.buf.WriteTo(w.ResponseWriter)
+	return err
+}
+
+// Flush stops buffering and sends everything written so far to the client.
+func (w *bufferWriter) Flush() {
+	w.startStreaming()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *bufferWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *bufferWriter) finish() {
+	if w.streaming {
+		return
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.head && w.Header().Get("Content-Length") == "" && bodyAllowed(w.status) {
+		w.Header().Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.buf.WriteTo(w.ResponseWriter)
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// BufferJSONMiddleware buffers response bodies of up to maxBuffer bytes, so
+// they can be sent with a Content-Length header instead of chunked encoding.
+// Some HTTP clients handle small JSON responses better when the length is
+// known up front.
+//
+// If the body grows past maxBuffer bytes, or the handler calls Flush, the
+// buffered data is sent and the rest of the response is streamed as normal.
+// The status code is held back along with the body, so middleware wrapping
+// BufferJSONMiddleware sees the status when the response is sent.
+func BufferJSONMiddleware(h http.Handler, maxBuffer int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bw := &bufferWriter{ResponseWriter: w, max: maxBuffer, head: r.Method == "HEAD"}
+		h.ServeHTTP(bw, r)
+		bw.finish()
+	})
+}
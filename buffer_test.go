@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestBufferJSONSetsContentLength(t *testing.T) {
+	h := BufferJSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":`))
+		w.Write([]byte(`"123"}`))
+	}), 1024)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusCreated)
+	test.AssertEquals(t, w.Header().Get("Content-Length"), "12")
+	test.AssertEquals(t, w.Body.String(), `{"id":"123"}`)
+}
+
+func TestBufferJSONStreamsLargeBodies(t *testing.T) {
+	big := strings.Repeat("a", 100)
+	h := BufferJSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(big))
+		w.Write([]byte(big))
+	}), 150)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Header().Get("Content-Length"), "")
+	test.AssertEquals(t, w.Body.String(), big+big)
+}
+
+func TestBufferJSONHead(t *testing.T) {
+	h := BufferJSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+	}), 1024)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("HEAD", "/v1/jobs/123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Header().Get("Content-Length"), "")
+}
+
+func TestBufferJSONUnwrap(t *testing.T) {
+	w := httptest.NewRecorder()
+	h := BufferJSONMiddleware(http.HandlerFunc(func(bw http.ResponseWriter, r *http.Request) {
+		u, ok := bw.(interface{ Unwrap() http.ResponseWriter })
+		test.Assert(t, ok, "expected the writer to have an Unwrap method")
+		test.Assert(t, u.Unwrap() == w, "expected Unwrap to return the underlying writer")
+	}), 1024)
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a response stored by CacheMiddleware.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// ResponseCache stores responses for CacheMiddleware. Implementations must be
+// safe for concurrent use.
+type ResponseCache interface {
+	// Get returns the response stored under key, or false if there isn't
+	// one or it has expired.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores resp under key for ttl.
+	Set(key string, resp *CachedResponse, ttl time.Duration)
+}
+
+type lruEntry struct {
+	key     string
+	resp    *CachedResponse
+	expires time.Time
+}
+
+// LRUCache is an in-memory ResponseCache that holds a fixed number of
+// responses, evicting the least recently used response when it's full.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+// NewLRUCache returns an LRUCache that holds up to size responses.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.resp, true
+}
+
+func (c *LRUCache) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		el.Value = &lruEntry{key: key, resp: resp, expires: expires}
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.ll.PushFront(&lruEntry{key: key, resp: resp, expires: expires})
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// cacheMaxBytes is the largest response body CacheMiddleware caches.
+const cacheMaxBytes = 1 << 20
+
+// CacheMiddleware caches successful responses to GET requests in store for
+// ttl, and serves later requests with the same key from the cache. keyFn
+// returns the cache key for a request, for example its URL; requests for
+// which it returns the empty string are not cached. Cached responses have an
+// "X-Cache: HIT" header, and responses from h an "X-Cache: MISS" header.
+//
+// A cached response only includes the headers set by h. Headers set by
+// middleware outside CacheMiddleware, like X-Request-Id or Server-Timing,
+// are set fresh for each request, and aren't replaced by the cached values.
+//
+// Only 200 responses are cached. Responses that set a cookie, or have a body
+// over 1MB, are never cached.
+func CacheMiddleware(h http.Handler, store ResponseCache, keyFn func(*http.Request) string, ttl time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := keyFn(r)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if cached, ok := store.Get(key); ok {
+			copyNewHeaders(w.Header(), cached.Header)
+			w.Header().Set("X-Cache", "HIT")
+			w.WriteHeader(cached.Status)
+			w.Write(cached.Body)
+			return
+		}
+		w.Header().Set("X-Cache", "MISS")
+		resp := new(sharedResponse)
+		tw := newTeeWriter(w, resp, cacheMaxBytes)
+		h.ServeHTTP(tw, r)
+		if !tw.wroteHeader {
+			tw.WriteHeader(http.StatusOK)
+		}
+		if resp.status != http.StatusOK || resp.truncated || resp.header.Get("Set-Cookie") != "" {
+			return
+		}
+		store.Set(key, &CachedResponse{
+			Status: resp.status,
+			Header: resp.header,
+			Body:   resp.body.Bytes(),
+		}, ttl)
+	})
+}
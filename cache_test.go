@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestCacheMiddleware(t *testing.T) {
+	calls := 0
+	h := CacheMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/cookie" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	}), NewLRUCache(10), func(r *http.Request) string {
+		return r.URL.String()
+	}, time.Minute)
+
+	for _, want := range []string{"MISS", "HIT"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Header().Get("X-Cache"), want)
+		test.AssertEquals(t, w.Header().Get("Content-Type"), "text/plain")
+		test.AssertEquals(t, w.Body.String(), "hello")
+		test.AssertEquals(t, calls, 1)
+	}
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/cookie", nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Header().Get("X-Cache"), "MISS")
+	}
+	test.AssertEquals(t, calls, 3)
+}
+
+func TestLRUCacheEvicts(t *testing.T) {
+	c := NewLRUCache(2)
+	c.Set("a", &CachedResponse{Status: 200}, time.Minute)
+	c.Set("b", &CachedResponse{Status: 200}, time.Minute)
+	c.Get("a")
+	c.Set("c", &CachedResponse{Status: 200}, time.Minute)
+	_, ok := c.Get("b")
+	test.Assert(t, !ok, "expected least recently used entry to be evicted")
+	_, ok = c.Get("a")
+	test.Assert(t, ok, "expected recently used entry to be kept")
+
+	c.Set("d", &CachedResponse{Status: 200}, -time.Second)
+	_, ok = c.Get("d")
+	test.Assert(t, !ok, "expected expired entry to be missing")
+}
+
+func TestCacheMiddlewareKeepsPerRequestHeaders(t *testing.T) {
+	h := RequestIDMiddleware(CacheMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	}), NewLRUCache(10), func(r *http.Request) string {
+		return r.URL.String()
+	}, time.Minute))
+
+	var ids []string
+	for _, want := range []string{"MISS", "HIT"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Header().Get("X-Cache"), want)
+		test.AssertEquals(t, w.Header().Get("Content-Type"), "text/plain")
+		test.AssertEquals(t, len(w.Header().Values(RequestIDHeader)), 1)
+		ids = append(ids, w.Header().Get(RequestIDHeader))
+	}
+	test.Assert(t, ids[0] != ids[1], "expected the HIT to have its own request ID")
+}
+
+func TestCacheMiddlewareCopiesHeaders(t *testing.T) {
+	cached := CacheMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", "1")
+		w.Write([]byte("hello"))
+	}), NewLRUCache(10), func(r *http.Request) string {
+		return r.URL.String()
+	}, time.Minute)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cached.ServeHTTP(w, r)
+		// Changing a header after a HIT shouldn't change the cache.
+		w.Header()["X-Version"][0] = "2"
+	})
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Result().Header.Get("X-Version"), "1")
+	}
+}
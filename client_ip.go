@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client that sent r. If the
+// connection comes from one of trustedProxies, like a load balancer, the
+// X-Forwarded-For header is read from right to left, skipping the addresses
+// of further trusted proxies, and the first untrusted address is returned:
+// that's the closest hop that wasn't added by a proxy you run. Addresses to
+// the left of it were sent by the client, and could be anything, so they're
+// ignored. If every address in the header is trusted, the left-most one is
+// returned.
+//
+// If the connection doesn't come from a trusted proxy, the header is
+// ignored and the address of the connection is returned, so clients can't
+// pick their own IP by setting X-Forwarded-For. ClientIP returns nil if
+// r.RemoteAddr can't be parsed, which doesn't happen for requests received
+// by net/http.
+//
+// IPv6 addresses are accepted with or without brackets, and ports on
+// forwarded addresses are ignored. Use ClientIP for anything keyed by client
+// address, like rate limits, allow lists and logs, so they all agree on who
+// the client is.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	ip := parseHostIP(r.RemoteAddr)
+	if ip == nil || !trustedIP(ip, trustedProxies) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHostIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// A malformed entry means nothing to the left of it can be
+			// trusted either; the last proxy is the best we know.
+			return ip
+		}
+		ip = hop
+		if !trustedIP(ip, trustedProxies) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// parseHostIP parses an IP address with an optional port, like
+// "192.0.2.1", "192.0.2.1:1234", "2001:db8::1" or "[2001:db8::1]:1234".
+func parseHostIP(s string) net.IP {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+}
+
+func trustedIP(ip net.IP, trustedProxies []*net.IPNet) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestClientIP(t *testing.T) {
+	var trusted []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "fd00::/8"} {
+		_, n, err := net.ParseCIDR(cidr)
+		test.AssertNotError(t, err, "")
+		trusted = append(trusted, n)
+	}
+	for _, tt := range []struct {
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"203.0.113.7:5000", nil, "203.0.113.7"},
+		{"203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"10.0.0.1:5000", nil, "10.0.0.1"},
+		{"10.0.0.1:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:5000", []string{"1.2.3.4, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:5000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:5000", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:5000", []string{"198.51.100.1, garbage"}, "10.0.0.1"},
+		{"10.0.0.1:5000", []string{""}, "10.0.0.1"},
+		{"[fd00::1]:5000", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"[fd00::1]:5000", []string{"[2001:db8::2]:443, fd00::2"}, "2001:db8::2"},
+		{"[2001:db8::9]:5000", []string{"198.51.100.1"}, "2001:db8::9"},
+		{"203.0.113.7", nil, "203.0.113.7"},
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		for _, v := range tt.xff {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		test.AssertEquals(t, ClientIP(req, trusted).String(), tt.want)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "not an address"
+	test.Assert(t, ClientIP(req, trusted) == nil, "expected nil for an invalid RemoteAddr")
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+func newOverloaded(r *http.Request) *Error {
+	return &Error{
+		Title:      "Server overloaded",
+		Id:         "overloaded",
+		Detail:     "The server is handling too many requests. Please try again later",
+		Instance:   r.URL.Path,
+		StatusCode: http.StatusServiceUnavailable,
+	}
+}
+
+// MethodConcurrencyLimitMiddleware limits the number of requests for each
+// method in limits that h can serve at once. For example, passing
+// {"POST": 10} allows 10 concurrent POST requests; the 11th gets a 503
+// error until one of the others finishes. Methods that aren't in limits
+// are not limited.
+//
+// A request's slot is released when h returns, even if h panics.
+func MethodConcurrencyLimitMiddleware(h http.Handler, limits map[string]int) http.Handler {
+	sems := make(map[string]chan struct{}, len(limits))
+	for method, limit := range limits {
+		sems[strings.ToUpper(method)] = make(chan struct{}, limit)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sem, ok := sems[strings.ToUpper(r.Method)]
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			WriteError(w, newOverloaded(r))
+			return
+		}
+		defer func() { <-sem }()
+		h.ServeHTTP(w, r)
+	})
+}
+
+var (
+	inFlight        = new(expvar.Int)
+	publishInFlight sync.Once
+)
+
+// InFlightMiddleware counts the requests h is serving, and publishes the
+// count as the "http_in_flight" expvar, for example for autoscaling. If
+// there's more than one InFlightMiddleware, they update the same count.
+func InFlightMiddleware(h http.Handler) http.Handler {
+	publishInFlight.Do(func() {
+		expvar.Publish("http_in_flight", inFlight)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CurrentInFlight returns the number of requests being served by
+// InFlightMiddleware.
+func CurrentInFlight() int64 {
+	return inFlight.Value()
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestMethodConcurrencyLimit(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := MethodConcurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			started <- struct{}{}
+			<-release
+		}
+	}), map[string]int{"POST": 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/v1/jobs", nil)
+			h.ServeHTTP(w, req)
+		}()
+		<-started
+	}
+
+	// Both POST slots are taken.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusServiceUnavailable)
+	test.AssertContains(t, w.Body.String(), "overloaded")
+
+	// GET is not limited.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+
+	close(release)
+	wg.Wait()
+}
+
+func TestMethodConcurrencyLimitReleasesOnPanic(t *testing.T) {
+	h := MethodConcurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), map[string]int{"DELETE": 1})
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() { recover() }()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/v1/jobs/1", nil)
+			h.ServeHTTP(w, req)
+			t.Fatalf("expected handler to panic, got %d", w.Code)
+		}()
+	}
+}
+
+func TestInFlightMiddleware(t *testing.T) {
+	var during int64
+	h := InFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = CurrentInFlight()
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+	}))
+	before := CurrentInFlight()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertEquals(t, during, before+1)
+	test.AssertEquals(t, CurrentInFlight(), before)
+
+	func() {
+		defer func() { recover() }()
+		req, _ := http.NewRequest("GET", "/panic", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	test.AssertEquals(t, CurrentInFlight(), before)
+	test.AssertEquals(t, expvar.Get("http_in_flight").String(), strconv.FormatInt(before, 10))
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"os"
+)
+
+// contentTypeWriter records whether the Content-Type header was set when the
+// response started.
+type contentTypeWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	hasType     bool
+	missing     bool
+}
+
+func (w *contentTypeWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = code
+		w.hasType = w.Header().Get("Content-Type") != ""
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *contentTypeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if len(b) > 0 && !w.hasType && w.status >= 200 && w.status < 300 {
+		w.missing = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *contentTypeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *contentTypeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// RequireContentTypeSetMiddleware logs a warning naming the route when h
+// writes a successful (2xx) response with a body but without setting the
+// Content-Type header, in which case net/http guesses the type from the
+// body. The response itself isn't changed. It's meant to catch mistakes in
+// development and tests.
+//
+// The middleware is only active if the DEBUG_CONTENT_TYPE environment
+// variable is set to true; otherwise it calls h directly.
+func RequireContentTypeSetMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if os.Getenv("DEBUG_CONTENT_TYPE") != "true" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cw := &contentTypeWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r)
+		if cw.missing {
+			log.Printf("server: %s %s (route %s) wrote a %d response without a Content-Type", r.Method, r.URL.Path, routeLabel(h, r), cw.status)
+		}
+	})
+}
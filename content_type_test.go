@@ -0,0 +1,44 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestRequireContentTypeSet(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	t.Setenv("DEBUG_CONTENT_TYPE", "true")
+
+	rh := new(RegexpHandler)
+	rh.Handler(BuildRoute(`^/v1/untyped$`), []string{"GET"}, okHandler)
+	rh.HandleContentType(BuildRoute(`^/v1/typed$`), []string{"GET"}, "text/csv", okHandler)
+	rh.HandleFunc(BuildRoute(`^/v1/empty$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := RequireContentTypeSetMiddleware(rh)
+
+	for _, path := range []string{"/v1/typed", "/v1/empty", "/v1/missing"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	test.AssertEquals(t, buf.String(), "")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/untyped", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Body.String(), "ok")
+	test.AssertContains(t, buf.String(), "route ^/v1/untyped$")
+
+	buf.Reset()
+	t.Setenv("DEBUG_CONTENT_TYPE", "")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertEquals(t, buf.String(), "")
+}
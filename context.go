@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextKey is the type of the keys this package stores in a request's
+// context. Using an unexported type means the keys can't collide with keys
+// defined in other packages, and that the values can only be read and
+// written through this package's accessors:
+//
+//   - the request ID: WithRequestID, RequestID and RequestIDFromContext.
+//   - the matched route: WithRoute, MatchedPattern, Params, ParamsByIndex
+//     and AllowedMethods, plus FromContext variants.
+//   - Server-Timing entries: AddTiming.
+//   - dependency timings: StartDep.
+//   - the time budget: RemainingBudget.
+//   - the host the client requested: OriginalHost.
+//   - the Content-Security-Policy nonce: CSPNonce.
+//
+// Features that need to store their own per-request values should add a key
+// here and a pair of accessors, rather than defining new key types.
+type contextKey int
+
+const (
+	// timingsKey holds the *timings for a request served by
+	// ServerTimingMiddleware.
+	timingsKey contextKey = iota
+
+	// routeMatchKey holds the *routeMatch for the route that RegexpHandler
+	// matched.
+	routeMatchKey
+
+	// requestIDKey holds the request ID string assigned by
+	// RequestIDMiddleware.
+	requestIDKey
+
+	// depTimingsKey holds the *depTimings for a request served by
+	// DepTimingMiddleware.
+	depTimingsKey
+
+	// budgetKey holds the time.Time deadline BudgetMiddleware computed from
+	// the request's time budget.
+	budgetKey
+
+	// originalHostKey holds the Host a request had before
+	// SetHostMiddleware replaced it.
+	originalHostKey
+
+	// cspNonceKey holds the nonce string CSPNonceMiddleware generated for
+	// the request.
+	cspNonceKey
+)
+
+// ContextMiddleware calls fn to derive a new context for each request, for
+// example one carrying the tenant resolved from the request's subdomain, and
+// calls h with that context. If fn returns an Error, it's written to the
+// client and h is not called.
+func ContextMiddleware(h http.Handler, fn func(*http.Request) (context.Context, *Error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := fn(r)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+type tenantKey struct{}
+
+func TestContextMiddleware(t *testing.T) {
+	h := ContextMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Context().Value(tenantKey{}).(string)))
+	}), func(r *http.Request) (context.Context, *Error) {
+		if r.Host != "acme.example.com" {
+			return nil, &Error{Title: "Unknown tenant", Id: "unknown_tenant", StatusCode: http.StatusNotFound}
+		}
+		return context.WithValue(r.Context(), tenantKey{}, "acme"), nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://acme.example.com/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Body.String(), "acme")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://other.example.com/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+	test.AssertContains(t, w.Body.String(), "unknown_tenant")
+}
+
+func TestContextAccessors(t *testing.T) {
+	ctx := context.Background()
+	test.AssertEquals(t, RequestIDFromContext(ctx), "")
+	test.AssertEquals(t, MatchedPatternFromContext(ctx), "")
+	test.Assert(t, AllowedMethodsFromContext(ctx) == nil, "expected no allowed methods")
+
+	route := BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`)
+	ctx = WithRequestID(ctx, "req_123")
+	ctx = WithRoute(ctx, route, "/v1/jobs/job_456", []string{"GET"})
+	test.AssertEquals(t, RequestIDFromContext(ctx), "req_123")
+	test.AssertEquals(t, MatchedPatternFromContext(ctx), route.String())
+	test.AssertDeepEquals(t, ParamsFromContext(ctx), map[string]string{"Id": "job_456"})
+	test.AssertDeepEquals(t, AllowedMethodsFromContext(ctx), []string{"GET"})
+}
+
+func TestAllowedMethods(t *testing.T) {
+	h := new(RegexpHandler)
+	var methods []string
+	h.HandleFunc(BuildRoute(`^/v1/jobs$`), []string{"GET", "POST"}, func(w http.ResponseWriter, r *http.Request) {
+		methods = AllowedMethods(r)
+	})
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertDeepEquals(t, methods, []string{"GET", "POST"})
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// CSPNoncePlaceholder is replaced with the request's nonce in the policy
+// passed to CSPNonceMiddleware.
+const CSPNoncePlaceholder = "{nonce}"
+
+// CSPNonceMiddleware generates a random nonce for each request and sets the
+// Content-Security-Policy header to policy, with every "{nonce}" replaced by
+// the nonce:
+//
+//	h = server.CSPNonceMiddleware(h, "default-src 'self'; script-src 'nonce-{nonce}'")
+//
+// Handlers read the nonce with CSPNonce and add it to the inline scripts
+// they render, like <script nonce="{{ .Nonce }}">, so the browser runs those
+// scripts and no others. The nonce is 128 bits from crypto/rand, encoded with
+// standard base64, and is new for every request.
+func CSPNonceMiddleware(h http.Handler, policy string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := newCSPNonce()
+		w.Header().Set("Content-Security-Policy", strings.ReplaceAll(policy, CSPNoncePlaceholder, nonce))
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cspNonceKey, nonce)))
+	})
+}
+
+// CSPNonce returns the nonce CSPNonceMiddleware generated for r, or the
+// empty string if there isn't one.
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceKey).(string)
+	return nonce
+}
+
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
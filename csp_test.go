@@ -0,0 +1,33 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestCSPNonce(t *testing.T) {
+	var nonce string
+	h := CSPNonceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(r)
+	}), "default-src 'self'; script-src 'self' 'nonce-{nonce}'")
+
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		h.ServeHTTP(w, req)
+		b, err := base64.StdEncoding.DecodeString(nonce)
+		test.AssertNotError(t, err, "")
+		test.AssertEquals(t, len(b), 16)
+		test.Assert(t, !seen[nonce], "expected a new nonce for each request")
+		seen[nonce] = true
+		test.AssertEquals(t, w.Header().Get("Content-Security-Policy"), "default-src 'self'; script-src 'self' 'nonce-"+nonce+"'")
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	test.AssertEquals(t, CSPNonce(req), "")
+}
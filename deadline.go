@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ErrRequestDeadlineExceeded is returned when reading the body of a request
+// served by RequestDeadlineMiddleware, after the request's deadline passes.
+var ErrRequestDeadlineExceeded = errors.New("server: request deadline exceeded")
+
+type deadlineBody struct {
+	io.ReadCloser
+}
+
+func (b deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		err = ErrRequestDeadlineExceeded
+	}
+	return n, err
+}
+
+// RequestDeadlineMiddleware bounds the total time a request can take,
+// including reading the request body and writing the response, by setting
+// read and write deadlines on the underlying connection d after the request
+// arrives. Unlike a handler timeout, this catches clients that send the body
+// very slowly to tie up the server.
+//
+// Once the deadline passes, reads from the request body fail with
+// ErrRequestDeadlineExceeded, so handlers can stop work, and writes to the
+// connection fail, so the client sees the connection close.
+//
+// RequestDeadlineMiddleware uses http.ResponseController, and requires Go
+// 1.20 or newer. If the ResponseWriter doesn't support deadlines, requests
+// are served without one.
+func RequestDeadlineMiddleware(h http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline := time.Now().Add(d)
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(deadline); err == nil {
+			r.Body = deadlineBody{r.Body}
+		}
+		rc.SetWriteDeadline(deadline)
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestRequestDeadlineSlowBody(t *testing.T) {
+	errs := make(chan error, 1)
+	s := httptest.NewServer(RequestDeadlineMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		errs <- err
+	}), 20*time.Millisecond))
+	defer s.Close()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		// Drip the body a byte at a time, and never finish it.
+		for {
+			if _, err := pw.Write([]byte{' '}); err != nil {
+				return
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+	}()
+	req, _ := http.NewRequest("POST", s.URL, pr)
+	// The server lingers on the connection for a while after a chunked or
+	// keep-alive request with an unread body, and s.Close waits for it.
+	req.ContentLength = 1 << 20
+	req.Close = true
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	select {
+	case err := <-errs:
+		test.AssertEquals(t, err, ErrRequestDeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("handler still reading the body after the deadline")
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// DecodeJSON decodes the request body as JSON into v, which must be a
+// pointer, like json.Decoder.Decode. If the body can't be decoded,
+// DecodeJSON writes a 400 error with the id "invalid_json" to w and returns
+// false. Handlers should return immediately in that case:
+//
+//	var job Job
+//	if !server.DecodeJSON(w, r, &job) {
+//		return
+//	}
+//
+// The error's Detail tells the client what to fix without exposing the
+// parser's messages: the line and column of a syntax error, or the name of
+// a field with the wrong type, like
+//
+//	The "pickup.zip" field must be a string, not a number
+//
+// If r.Body was wrapped with http.MaxBytesReader and the body is over the
+// limit, DecodeJSON writes a 413 error with the id "request_too_large"
+// instead.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	buf := &prefixBuffer{max: decodePositionBytes}
+	if err := json.NewDecoder(io.TeeReader(r.Body, buf)).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, newRequestTooLarge(r, tooLarge.Limit))
+			return false
+		}
+		WriteError(w, &Error{
+			Title:      "Invalid JSON",
+			Id:         "invalid_json",
+			Detail:     decodeErrorDetail(err, buf.Bytes()),
+			Instance:   r.URL.Path,
+			StatusCode: http.StatusBadRequest,
+		})
+		return false
+	}
+	return true
+}
+
+// DecodeJSONObject decodes the request body, which must be a JSON object,
+// into a map. If the body is not valid JSON, or is valid JSON but not an
+// object (for example an array or a string), DecodeJSONObject writes a 400
+// error to w and returns false. Handlers should return immediately in that
+// case:
+//
+//	obj, ok := server.DecodeJSONObject(w, r)
+//	if !ok {
+//		return
+//	}
+func DecodeJSONObject(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	var v interface{}
+	if !DecodeJSON(w, r, &v) {
+		return nil, false
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		WriteError(w, &Error{
+			Title:      "Expected a JSON object",
+			Id:         "expected_object",
+			Detail:     "The request body must be a JSON object",
+			Instance:   r.URL.Path,
+			StatusCode: http.StatusBadRequest,
+		})
+		return nil, false
+	}
+	return obj, true
+}
+
+// decodePositionBytes is how much of the body DecodeJSON keeps to find the
+// line and column of a syntax error.
+const decodePositionBytes = 64 << 10
+
+// prefixBuffer keeps the first max bytes written to it and discards the
+// rest.
+type prefixBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (b *prefixBuffer) Write(p []byte) (int, error) {
+	if n := b.max - b.buf.Len(); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		b.buf.Write(p[:n])
+	}
+	return len(p), nil
+}
+
+func (b *prefixBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// decodeErrorDetail describes err, returned by decoding body, for the
+// client. body is the start of the request body, and may not include all of
+// it.
+func decodeErrorDetail(err error, body []byte) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return "The request body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "The request body ended before the JSON value was complete"
+	case errors.As(err, &syntaxErr):
+		if syntaxErr.Offset > int64(len(body)) {
+			return fmt.Sprintf("The request body has a syntax error at byte %d", syntaxErr.Offset)
+		}
+		line, col := lineAndColumn(body, syntaxErr.Offset)
+		return fmt.Sprintf("The request body has a syntax error at line %d, column %d", line, col)
+	case errors.As(err, &typeErr):
+		want := jsonTypeName(typeErr.Type)
+		// Value is like "string" or "number 1.5".
+		got, _, _ := strings.Cut(typeErr.Value, " ")
+		if got == "bool" {
+			got = "boolean"
+		}
+		if typeErr.Field == "" {
+			return fmt.Sprintf("The request body must be %s, not %s", want, withArticle(got))
+		}
+		return fmt.Sprintf("The %q field must be %s, not %s", typeErr.Field, want, withArticle(got))
+	default:
+		return "The request body could not be parsed as JSON"
+	}
+}
+
+// lineAndColumn returns the 1-based line and column of the byte at offset
+// in body. encoding/json reports the offset just after the bad byte, so
+// that's the byte before offset.
+func lineAndColumn(body []byte, offset int64) (int, int) {
+	before := body[:offset]
+	if len(before) > 0 {
+		before = before[:len(before)-1]
+	}
+	line := bytes.Count(before, []byte{'\n'}) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// jsonTypeName returns the JSON type a value of t is decoded from, with an
+// article, like "a string".
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Ptr:
+		return jsonTypeName(t.Elem())
+	default:
+		return "a " + t.String()
+	}
+}
+
+func withArticle(s string) string {
+	switch s {
+	case "array", "object":
+		return "an " + s
+	default:
+		return "a " + s
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+var decodeObjectTests = []struct {
+	body   string
+	ok     bool
+	status int
+	id     string
+}{
+	{`{"name": "job"}`, true, 200, ""},
+	{`[1, 2]`, false, 400, "expected_object"},
+	{`"hello"`, false, 400, "expected_object"},
+	{`null`, false, 400, "expected_object"},
+	{`{"name": `, false, 400, "invalid_json"},
+}
+
+func TestDecodeJSONObject(t *testing.T) {
+	for _, tt := range decodeObjectTests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/admin", strings.NewReader(tt.body))
+		obj, ok := DecodeJSONObject(w, req)
+		test.AssertEquals(t, ok, tt.ok)
+		test.AssertEquals(t, w.Code, tt.status)
+		if tt.ok {
+			test.AssertEquals(t, obj["name"], "job")
+		} else {
+			test.AssertContains(t, w.Body.String(), tt.id)
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	type pickup struct {
+		Zip string `json:"zip"`
+	}
+	type job struct {
+		Name   string   `json:"name"`
+		Count  int      `json:"count"`
+		Tags   []string `json:"tags"`
+		Pickup pickup   `json:"pickup"`
+	}
+	for _, tt := range []struct {
+		body   string
+		detail string
+	}{
+		{``, "The request body is empty"},
+		{`{"name": `, "The request body ended before the JSON value was complete"},
+		{`{"name": x}`, "The request body has a syntax error at line 1, column 10"},
+		{"{\n  \"name\": \"job\",\n  \"count\": 1,,\n}", "The request body has a syntax error at line 3, column 14"},
+		{`{"count": "three"}`, `The "count" field must be an integer, not a string`},
+		{`{"count": 1.5}`, `The "count" field must be an integer, not a number`},
+		{`{"name": true}`, `The "name" field must be a string, not a boolean`},
+		{`{"tags": {}}`, `The "tags" field must be an array, not an object`},
+		{`{"pickup": {"zip": 94110}}`, `The "pickup.zip" field must be a string, not a number`},
+		{`[1, 2]`, "The request body must be an object, not an array"},
+		{strings.Repeat(" ", decodePositionBytes) + "x", fmt.Sprintf("The request body has a syntax error at byte %d", decodePositionBytes+1)},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(tt.body))
+		var j job
+		test.Assert(t, !DecodeJSON(w, req, &j), "expected "+tt.body+" not to decode")
+		test.AssertErrorResponse(t, w, http.StatusBadRequest, "invalid_json")
+		var e Error
+		test.AssertNotError(t, json.Unmarshal(w.Body.Bytes(), &e), "")
+		test.AssertEquals(t, e.Detail, tt.detail)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"name": "job", "count": 3, "pickup": {"zip": "94110"}}`))
+	var j job
+	test.Assert(t, DecodeJSON(w, req, &j), "expected the body to decode")
+	test.AssertEquals(t, j.Name, "job")
+	test.AssertEquals(t, j.Count, 3)
+	test.AssertEquals(t, j.Pickup.Zip, "94110")
+}
+
+func TestDecodeJSONBodyTooLarge(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"name": "job"}`))
+	req.Body = http.MaxBytesReader(w, req.Body, 5)
+	var v interface{}
+	test.Assert(t, !DecodeJSON(w, req, &v), "expected the body not to decode")
+	test.AssertErrorResponse(t, w, http.StatusRequestEntityTooLarge, "request_too_large")
+}
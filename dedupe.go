@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiringSet is a set of keys that are forgotten after a TTL. Expired keys
+// are swept out as new keys are added, so the set's memory stays bounded by
+// the number of keys added per TTL.
+type expiringSet struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	seen      map[[sha256.Size]byte]time.Time
+	lastSweep time.Time
+}
+
+func newExpiringSet(ttl time.Duration) *expiringSet {
+	return &expiringSet{ttl: ttl, seen: make(map[[sha256.Size]byte]time.Time), lastSweep: time.Now()}
+}
+
+// add adds key to the set, and reports whether it was already present.
+func (s *expiringSet) add(key [sha256.Size]byte, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > s.ttl {
+		for k, expires := range s.seen {
+			if now.After(expires) {
+				delete(s.seen, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	if expires, ok := s.seen[key]; ok && !now.After(expires) {
+		return true
+	}
+	s.seen[key] = now.Add(s.ttl)
+	return false
+}
+
+// remove removes key from the set.
+func (s *expiringSet) remove(key [sha256.Size]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.seen, key)
+}
+
+// DedupeMiddleware rejects accidental double submissions, like a
+// double-clicked form. A request is a duplicate if another request with the
+// same key and the same body arrived in the last window; duplicates get a
+// 409 error. keyFn identifies the client and the operation, for example the
+// client IP and the path; requests for which it returns the empty string are
+// not checked.
+//
+// Only POST, PUT, PATCH and DELETE requests are checked. The body is read to
+// compute its hash, and restored for h; bodies larger than
+// MaxBufferedBodyBytes get a 413 error.
+//
+// A request that fails with a server error (a status of 500 or above), or
+// panics, isn't remembered, so the client can retry it straight away.
+func DedupeMiddleware(h http.Handler, window time.Duration, keyFn func(*http.Request) string) http.Handler {
+	seen := newExpiringSet(window)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := strings.ToUpper(r.Method)
+		switch method {
+		case "POST", "PUT", "PATCH", "DELETE":
+		default:
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := keyFn(r)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, ok := readBody(w, r, MaxBufferedBodyBytes)
+		if !ok {
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		bodySum := sha256.Sum256(body)
+		hash := sha256.New()
+		io.WriteString(hash, method)
+		hash.Write([]byte{0})
+		io.WriteString(hash, key)
+		hash.Write([]byte{0})
+		hash.Write(bodySum[:])
+		var sum [sha256.Size]byte
+		copy(sum[:], hash.Sum(nil))
+		if seen.add(sum, time.Now()) {
+			WriteError(w, &Error{
+				Title:      "Duplicate request",
+				Id:         "duplicate_request",
+				Detail:     "An identical request was received moments ago",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusConflict,
+			})
+			return
+		}
+		rec := NewStatusRecorder(w)
+		served := false
+		defer func() {
+			if !served || rec.Status >= http.StatusInternalServerError {
+				seen.remove(sum)
+			}
+		}()
+		h.ServeHTTP(rec, r)
+		served = true
+	})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestDedupeMiddleware(t *testing.T) {
+	var bodies []string
+	h := DedupeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}), time.Minute, func(r *http.Request) string {
+		return r.RemoteAddr + r.URL.Path
+	})
+	codes := make([]int, 0)
+	for i, body := range []string{`{"a": 1}`, `{"a": 1}`, `{"a": 2}`, `{"a": 2}`} {
+		method := "POST"
+		if i == 3 {
+			method = "post"
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/v1/jobs", strings.NewReader(body))
+		req.RemoteAddr = "10.0.0.1:5000"
+		h.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	test.AssertDeepEquals(t, codes, []int{200, 409, 200, 409})
+	test.AssertDeepEquals(t, bodies, []string{`{"a": 1}`, `{"a": 2}`})
+}
+
+func TestDedupeMiddlewareRetryAfterFailure(t *testing.T) {
+	fail := true
+	calls := 0
+	h := DedupeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if fail {
+			fail = false
+			WriteError(w, new500(r))
+		}
+	}), time.Minute, func(r *http.Request) string {
+		return r.URL.Path
+	})
+	codes := make([]int, 0)
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"a": 1}`))
+		h.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	test.AssertDeepEquals(t, codes, []int{500, 200, 409})
+	test.AssertEquals(t, calls, 2)
+}
+
+func TestExpiringSetExpires(t *testing.T) {
+	s := newExpiringSet(time.Second)
+	key := sha256.Sum256([]byte("key"))
+	now := time.Now()
+	test.Assert(t, !s.add(key, now), "first add should not be a duplicate")
+	test.Assert(t, s.add(key, now.Add(500*time.Millisecond)), "second add should be a duplicate")
+	test.Assert(t, !s.add(key, now.Add(2*time.Second)), "add after the TTL should not be a duplicate")
+	test.AssertEquals(t, len(s.seen), 1)
+}
+
+func TestDedupeMiddlewareBodyTooLarge(t *testing.T) {
+	h := DedupeMiddleware(okHandler, time.Minute, func(r *http.Request) string {
+		return r.URL.Path
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(strings.Repeat("a", MaxBufferedBodyBytes+1)))
+	h.ServeHTTP(w, req)
+	test.AssertErrorResponse(t, w, http.StatusRequestEntityTooLarge, "request_too_large")
+}
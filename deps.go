@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// depBuckets are the upper bounds, in milliseconds, of the histogram
+// buckets DepTimingMiddleware publishes for each dependency.
+var depBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// depHistogram counts the calls to a dependency by duration.
+type depHistogram struct {
+	count  int64
+	sum    time.Duration
+	counts []int64 // one per bucket in depBuckets, plus one for slower calls
+}
+
+func (d *depHistogram) add(dur time.Duration) {
+	d.count++
+	d.sum += dur
+	ms := float64(dur) / float64(time.Millisecond)
+	i := sort.SearchFloat64s(depBuckets, ms)
+	d.counts[i]++
+}
+
+func (d *depHistogram) export() map[string]interface{} {
+	buckets := make(map[string]int64, len(d.counts))
+	for i, n := range d.counts {
+		if i < len(depBuckets) {
+			buckets[fmt.Sprintf("le_%g", depBuckets[i])] = n
+		} else {
+			buckets["le_inf"] = n
+		}
+	}
+	return map[string]interface{}{
+		"count":   d.count,
+		"sum_ms":  float64(d.sum) / float64(time.Millisecond),
+		"buckets": buckets,
+	}
+}
+
+var (
+	depMu          sync.Mutex
+	depHistograms  = make(map[string]*depHistogram)
+	publishDepVars sync.Once
+)
+
+func recordDep(name string, dur time.Duration) {
+	depMu.Lock()
+	defer depMu.Unlock()
+	d, ok := depHistograms[name]
+	if !ok {
+		d = &depHistogram{counts: make([]int64, len(depBuckets)+1)}
+		depHistograms[name] = d
+	}
+	d.add(dur)
+}
+
+// depTimings holds the total time a request spent in each dependency, in the
+// order the dependencies were first called.
+type depTimings struct {
+	mu    sync.Mutex
+	names []string
+	total map[string]time.Duration
+}
+
+func (t *depTimings) add(name string, dur time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.total[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.total[name] += dur
+}
+
+func (t *depTimings) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, len(t.names))
+	for i, name := range t.names {
+		parts[i] = formatTiming(name, t.total[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// StartDep starts timing a call to a dependency of the request, like the
+// database or an upstream API, and returns a function that stops the timer.
+// Call the function when the dependency returns:
+//
+//	stop := server.StartDep(r, "db")
+//	rows, err := db.QueryContext(r.Context(), query)
+//	stop()
+//
+// The stop function records the duration once; later calls do nothing. It's
+// safe to time dependencies from several goroutines. StartDep is a no-op if
+// the request is not being served by DepTimingMiddleware.
+func StartDep(r *http.Request, name string) func() {
+	t, ok := r.Context().Value(depTimingsKey).(*depTimings)
+	if !ok {
+		return func() {}
+	}
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			dur := time.Since(start)
+			t.add(name, dur)
+			recordDep(name, dur)
+		})
+	}
+}
+
+// DepTimingMiddleware collects the dependency timings recorded with StartDep.
+// The total time the request spent in each dependency is sent in a
+// Server-Timing header, for example "db;dur=12.500, cache;dur=0.310", and
+// every call is counted in a histogram for its dependency, published as the
+// "dependencies" expvar, with the count, total duration and buckets of
+// calls by duration in milliseconds.
+//
+// The header is set when the handler first writes the status or the body;
+// calls that finish after that point are only counted in the expvar.
+func DepTimingMiddleware(h http.Handler) http.Handler {
+	publishDepVars.Do(func() {
+		expvar.Publish("dependencies", expvar.Func(func() interface{} {
+			depMu.Lock()
+			defer depMu.Unlock()
+			deps := make(map[string]interface{}, len(depHistograms))
+			for name, d := range depHistograms {
+				deps[name] = d.export()
+			}
+			return deps
+		}))
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := &depTimings{total: make(map[string]time.Duration)}
+		tw := &timingWriter{ResponseWriter: w, header: t.header}
+		r = r.WithContext(context.WithValue(r.Context(), depTimingsKey, t))
+		h.ServeHTTP(tw, r)
+		tw.setHeader()
+	})
+}
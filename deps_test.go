@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+type depHistogramSnapshot map[string]struct {
+	Count   int64            `json:"count"`
+	Buckets map[string]int64 `json:"buckets"`
+}
+
+// depSnapshot returns the current value of the "dependencies" expvar,
+// which is shared by every test in the package.
+func depSnapshot(t *testing.T) depHistogramSnapshot {
+	t.Helper()
+	var deps depHistogramSnapshot
+	test.AssertNotError(t, json.Unmarshal([]byte(expvar.Get("dependencies").String()), &deps), "")
+	return deps
+}
+
+func TestDepTimingMiddleware(t *testing.T) {
+	h := DepTimingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stop := StartDep(r, "test_db")
+		time.Sleep(2 * time.Millisecond)
+		stop()
+		stop()
+		StartDep(r, "test_cache")()
+		StartDep(r, "test_db")()
+		w.Write([]byte("ok"))
+	}))
+	before := depSnapshot(t)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	parts := strings.Split(w.Header().Get("Server-Timing"), ", ")
+	test.AssertEquals(t, len(parts), 2)
+	test.Assert(t, strings.HasPrefix(parts[0], "test_db;dur="), "expected db timing first, got "+parts[0])
+	test.Assert(t, strings.HasPrefix(parts[1], "test_cache;dur="), "expected cache timing, got "+parts[1])
+
+	after := depSnapshot(t)
+	test.AssertEquals(t, after["test_db"].Count-before["test_db"].Count, int64(2))
+	test.AssertEquals(t, after["test_cache"].Count-before["test_cache"].Count, int64(1))
+	test.AssertEquals(t, after["test_cache"].Buckets["le_1"]-before["test_cache"].Buckets["le_1"], int64(1))
+}
+
+func TestStartDepWithoutMiddleware(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	StartDep(req, "db")()
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ClientGone returns a channel that's closed when the client that sent r
+// disconnects, or r's context is otherwise cancelled, for example by a
+// timeout. Long-running handlers can select on it to stop work nobody will
+// see:
+//
+//	select {
+//	case result := <-results:
+//		server.WriteJSON(w, 200, result)
+//	case <-server.ClientGone(r):
+//		return
+//	}
+func ClientGone(r *http.Request) <-chan struct{} {
+	return r.Context().Done()
+}
+
+var (
+	disconnects        = new(expvar.Int)
+	publishDisconnects sync.Once
+)
+
+// AbortOnDisconnectMiddleware logs requests whose client disconnected
+// before h returned, and counts them in the "http_client_disconnects"
+// expvar, to measure how much work is done for clients that have gone away.
+//
+// net/http cancels a request's context without a cause when the client
+// disconnects, so a context whose cause is context.Canceled counts as a
+// disconnect. A context that hit its deadline, or was cancelled with a
+// different cause (see context.WithCancelCause), does not.
+func AbortOnDisconnectMiddleware(h http.Handler) http.Handler {
+	publishDisconnects.Do(func() {
+		expvar.Publish("http_client_disconnects", disconnects)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		h.ServeHTTP(w, r)
+		ctx := r.Context()
+		if ctx.Err() != nil && errors.Is(context.Cause(ctx), context.Canceled) {
+			disconnects.Add(1)
+			log.Printf("server: client disconnected during %s %s (route %s) after %v", r.Method, r.URL.Path, routeLabel(h, r), time.Since(start).Round(time.Millisecond))
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestClientGone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/v1/jobs", nil)
+	select {
+	case <-ClientGone(req):
+		t.Fatal("expected ClientGone to block before the context is cancelled")
+	default:
+	}
+	cancel()
+	<-ClientGone(req)
+}
+
+func TestAbortOnDisconnect(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	var cancel func()
+	h := AbortOnDisconnectMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-ClientGone(r)
+	}))
+
+	before := disconnects.Value()
+	ctx, c := context.WithCancel(context.Background())
+	cancel = c
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/v1/jobs", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertEquals(t, disconnects.Value(), before+1)
+	test.AssertContains(t, buf.String(), "client disconnected during GET /v1/jobs")
+
+	buf.Reset()
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now())
+	req, _ = http.NewRequestWithContext(ctx, "GET", "/v1/jobs", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertEquals(t, disconnects.Value(), before+1)
+	test.AssertEquals(t, buf.String(), "")
+
+	req, _ = http.NewRequest("GET", "/v1/jobs", nil)
+	cancel = func() {}
+	h = AbortOnDisconnectMiddleware(okHandler)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertEquals(t, disconnects.Value(), before+1)
+}
@@ -1,6 +1,15 @@
 package server
 
-import "net/http"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
 
 // Error is an error you return from your HTTP API.
 type Error struct {
@@ -10,14 +19,80 @@ type Error struct {
 	Instance   string `json:"instance,omitempty"`
 	Type       string `json:"type,omitempty"`
 	StatusCode int    `json:"status_code,omitempty"`
+	RequestId  string `json:"request_id,omitempty"`
+	// Errors holds more specific errors, for example one for each invalid
+	// field in a request body.
+	Errors []Error `json:"errors,omitempty"`
+	// AllowedMethods is set on 405 errors, and lists the methods the
+	// resource accepts, like the Allow header.
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
 }
 
 func (e *Error) Error() string {
 	return e.Title
 }
 
-func new404(r *http.Request) Error {
-	return Error{
+// NewError returns an Error with the given status code, id and title. If
+// title is empty, the standard text for the status is used, for example
+// "Payment Required" for a 402.
+func NewError(status int, id, title string) *Error {
+	if title == "" {
+		title = http.StatusText(status)
+	}
+	return &Error{
+		Title:      title,
+		Id:         id,
+		StatusCode: status,
+	}
+}
+
+// NewErrorf returns an Error with the given status code and id, the standard
+// text for the status as the title, and a Detail formatted with fmt.Sprintf:
+//
+//	server.NewErrorf(451, "blocked", "Jobs can't be shipped to %s", country)
+func NewErrorf(status int, id, format string, args ...interface{}) *Error {
+	e := NewError(status, id, "")
+	e.Detail = fmt.Sprintf(format, args...)
+	return e
+}
+
+// ValidationError returns a 422 Error for a request that failed validation,
+// with an entry in Errors for each invalid field. fields maps the name of
+// each invalid field to a message describing the problem:
+//
+//	server.WriteError(w, server.ValidationError(map[string]string{
+//		"email": "Must be a valid email address",
+//		"name":  "Is required",
+//	}))
+//
+// The field errors have the id "invalid_field", the message as the Detail
+// and the field name as the Instance, and are sorted by field name.
+func ValidationError(fields map[string]string) *Error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]Error, len(names))
+	for i, name := range names {
+		errs[i] = Error{
+			Title:    "Invalid field",
+			Id:       "invalid_field",
+			Detail:   fields[name],
+			Instance: name,
+		}
+	}
+	return &Error{
+		Title:      "Validation failed",
+		Id:         "validation_failed",
+		Detail:     "One or more fields are invalid",
+		StatusCode: http.StatusUnprocessableEntity,
+		Errors:     errs,
+	}
+}
+
+func new404(r *http.Request) *Error {
+	return &Error{
 		Title:      "Resource not found",
 		Id:         "not_found",
 		Instance:   r.URL.Path,
@@ -25,11 +100,109 @@ func new404(r *http.Request) Error {
 	}
 }
 
-func new405(r *http.Request) Error {
-	return Error{
+func new405(r *http.Request) *Error {
+	return &Error{
 		Title:      "Method not allowed",
 		Id:         "method_not_allowed",
 		Instance:   r.URL.Path,
 		StatusCode: http.StatusMethodNotAllowed,
 	}
 }
+
+func new500(r *http.Request) *Error {
+	return &Error{
+		Title:      "Internal server error",
+		Id:         "server_error",
+		Instance:   r.URL.Path,
+		StatusCode: http.StatusInternalServerError,
+	}
+}
+
+// JSONEncoder encodes values as JSON. *json.Encoder implements it.
+type JSONEncoder interface {
+	Encode(v interface{}) error
+}
+
+var errorEncoder atomic.Value // of func(io.Writer) JSONEncoder
+
+// SetErrorEncoder sets the function WriteError, and so every error response
+// from this package, uses to encode errors. The default is json.NewEncoder,
+// which escapes <, > and & in strings. To turn that off, or indent the
+// output:
+//
+//	server.SetErrorEncoder(func(w io.Writer) server.JSONEncoder {
+//		enc := json.NewEncoder(w)
+//		enc.SetEscapeHTML(false)
+//		enc.SetIndent("", "  ")
+//		return enc
+//	})
+//
+// Passing nil restores the default. Call it before serving requests.
+func SetErrorEncoder(fn func(io.Writer) JSONEncoder) {
+	if fn == nil {
+		fn = defaultErrorEncoder
+	}
+	errorEncoder.Store(fn)
+}
+
+func defaultErrorEncoder(w io.Writer) JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+func newErrorEncoder(w io.Writer) JSONEncoder {
+	if fn, ok := errorEncoder.Load().(func(io.Writer) JSONEncoder); ok {
+		return fn(w)
+	}
+	return defaultErrorEncoder(w)
+}
+
+// WriteError writes e to w as JSON, using e.StatusCode as the HTTP status. If
+// the StatusCode is not set, a 500 is returned to the client.
+//
+// If e doesn't have a RequestId, WriteError uses the X-Request-Id header
+// already set on w, so clients can quote it in support requests. WriteError
+// doesn't have the request, so it can't read the ID from its context; it
+// relies on RequestIDMiddleware having set the response header before
+// calling the handler. A header set on w by anything else, like a handler
+// copying an upstream service's response headers, ends up in the error too.
+// To use a different ID, set it on e:
+//
+//	e.RequestId = server.RequestID(r)
+func WriteError(w http.ResponseWriter, e *Error) {
+	status := e.StatusCode
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	if e.RequestId == "" {
+		if id := w.Header().Get(RequestIDHeader); id != "" {
+			e2 := *e
+			e2.RequestId = id
+			e = &e2
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	newErrorEncoder(w).Encode(e)
+}
+
+// WriteRetryAfter writes e to w with the given status code, and a
+// Retry-After header telling the client how long to wait before trying
+// again. The header is written in seconds, rounded up, so a wait of 200ms is
+// sent as "Retry-After: 1".
+func WriteRetryAfter(w http.ResponseWriter, status int, after time.Duration, e *Error) {
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfterSeconds(after), 10))
+	e2 := *e
+	e2.StatusCode = status
+	WriteError(w, &e2)
+}
+
+func retryAfterSeconds(after time.Duration) int64 {
+	if after <= 0 {
+		return 0
+	}
+	secs := int64(after / time.Second)
+	if after%time.Second != 0 {
+		secs++
+	}
+	return secs
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+var retryAfterTests = []struct {
+	after time.Duration
+	want  string
+}{
+	{0, "0"},
+	{200 * time.Millisecond, "1"},
+	{time.Second, "1"},
+	{1500 * time.Millisecond, "2"},
+	{time.Minute, "60"},
+}
+
+func TestWriteRetryAfter(t *testing.T) {
+	for _, tt := range retryAfterTests {
+		w := httptest.NewRecorder()
+		WriteRetryAfter(w, http.StatusTooManyRequests, tt.after, &Error{Title: "Too many requests", Id: "rate_limited"})
+		test.AssertEquals(t, w.Code, http.StatusTooManyRequests)
+		test.AssertEquals(t, w.Header().Get("Retry-After"), tt.want)
+		test.AssertContains(t, w.Body.String(), `"status_code":429`)
+	}
+}
+
+func TestNewErrorDefaultTitle(t *testing.T) {
+	e := NewError(http.StatusPaymentRequired, "payment_required", "")
+	test.AssertEquals(t, e.Title, "Payment Required")
+	test.AssertEquals(t, e.StatusCode, 402)
+
+	e = NewError(http.StatusTooManyRequests, "rate_limited", "Slow down")
+	test.AssertEquals(t, e.Title, "Slow down")
+}
+
+func TestNewErrorf(t *testing.T) {
+	e := NewErrorf(http.StatusUnavailableForLegalReasons, "blocked", "Jobs can't be shipped to %s", "XX")
+	test.AssertEquals(t, e.Title, "Unavailable For Legal Reasons")
+	test.AssertEquals(t, e.Id, "blocked")
+	test.AssertEquals(t, e.Detail, "Jobs can't be shipped to XX")
+	test.AssertEquals(t, e.StatusCode, 451)
+}
+
+func TestSetErrorEncoder(t *testing.T) {
+	e := &Error{Title: "Bad <input> & more", Id: "bad_input", StatusCode: 400}
+	w := httptest.NewRecorder()
+	WriteError(w, e)
+	test.AssertContains(t, w.Body.String(), `\u003cinput\u003e \u0026 more`)
+
+	SetErrorEncoder(func(w io.Writer) JSONEncoder {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc
+	})
+	defer SetErrorEncoder(nil)
+	w = httptest.NewRecorder()
+	WriteError(w, e)
+	test.AssertContains(t, w.Body.String(), "\n  \"title\": \"Bad <input> & more\"")
+
+	SetErrorEncoder(nil)
+	w = httptest.NewRecorder()
+	WriteError(w, e)
+	test.AssertContains(t, w.Body.String(), `\u003cinput\u003e`)
+}
+
+func TestValidationError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteError(w, ValidationError(map[string]string{
+		"name":  "Is required",
+		"email": "Must be a valid email address",
+	}))
+	test.AssertErrorResponse(t, w, http.StatusUnprocessableEntity, "validation_failed")
+	var e Error
+	test.AssertNotError(t, json.Unmarshal(w.Body.Bytes(), &e), "")
+	test.AssertDeepEquals(t, e.Errors, []Error{
+		{Title: "Invalid field", Id: "invalid_field", Detail: "Must be a valid email address", Instance: "email"},
+		{Title: "Invalid field", Id: "invalid_field", Detail: "Is required", Instance: "name"},
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// maxErrorDetail is the most plain text error body JSONErrorWrapper copies
+// into the Detail field.
+const maxErrorDetail = 512
+
+type errorWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	intercept   bool
+	status      int
+	body        bytes.Buffer
+}
+
+func (w *errorWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	ct := w.Header().Get("Content-Type")
+	if code >= 400 && (ct == "" || strings.HasPrefix(ct, "text/plain")) {
+		w.intercept = true
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.intercept {
+		if room := maxErrorDetail - w.body.Len(); room > 0 {
+			if len(b) > room {
+				w.body.Write(b[:room])
+			} else {
+				w.body.Write(b)
+			}
+		}
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorWriter) Flush() {
+	if w.intercept {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// statusId converts a status code to an Error Id, for example 404 becomes
+// "not_found".
+func statusId(code int) string {
+	text := http.StatusText(code)
+	if text == "" {
+		return "error"
+	}
+	text = strings.ToLower(text)
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		if r == ' ' || r == '-' {
+			return '_'
+		}
+		return -1
+	}, text)
+}
+
+// JSONErrorWrapper converts plain text error responses from h into the
+// package's JSON Error format. Use it to wrap handlers from the standard
+// library, like http.ServeMux or http.FileServer, that report errors with
+// http.Error. A response is converted if its status is 400 or above and its
+// Content-Type is empty or text/plain; the text is included as the error's
+// Detail. Successful responses, and errors that already have another
+// content type, are passed through untouched.
+func JSONErrorWrapper(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &errorWriter{ResponseWriter: w}
+		h.ServeHTTP(ew, r)
+		if !ew.intercept {
+			return
+		}
+		title := http.StatusText(ew.status)
+		if title == "" {
+			title = "Error"
+		}
+		w.Header().Del("Content-Length")
+		w.Header().Del("X-Content-Type-Options")
+		WriteError(w, &Error{
+			Title:      title,
+			Id:         statusId(ew.status),
+			Detail:     strings.TrimSpace(ew.body.String()),
+			Instance:   r.URL.Path,
+			StatusCode: ew.status,
+		})
+	})
+}
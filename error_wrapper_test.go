@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestJSONErrorWrapper(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fine"))
+	})
+	mux.HandleFunc("/teapot", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(`{"custom": true}`))
+	})
+	h := JSONErrorWrapper(mux)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	test.AssertContains(t, w.Body.String(), `"id":"not_found"`)
+	test.AssertContains(t, w.Body.String(), `"detail":"404 page not found"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ok", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Body.String(), "fine")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/teapot", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusTeapot)
+	test.AssertEquals(t, w.Body.String(), `{"custom": true}`)
+}
+
+func TestStatusId(t *testing.T) {
+	test.AssertEquals(t, statusId(405), "method_not_allowed")
+	test.AssertEquals(t, statusId(418), "im_a_teapot")
+	test.AssertEquals(t, statusId(999), "error")
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ExpectContinueMiddleware runs precheck on requests that send an "Expect:
+// 100-continue" header, before anything reads the request body. If precheck
+// returns an Error, it's written to the client and h is not called; since
+// the body was never read, the server doesn't send "100 Continue" and the
+// client can skip uploading it. If precheck returns nil, the request is
+// passed to h, and the server sends "100 Continue" the first time h reads
+// the body. Requests without the header are passed to h unchanged.
+//
+// Use precheck for checks that only need the headers, like authentication.
+// A RegexpHandler's MaxBodyBytes limits also reject a Content-Length that's
+// too large before the body is read, so the client isn't told to continue;
+// but a body sent without a Content-Length is only limited as it's read,
+// after the client has been told to continue.
+func ExpectContinueMiddleware(h http.Handler, precheck func(*http.Request) *Error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expectsContinue(r) {
+			if err := precheck(r); err != nil {
+				WriteError(w, err)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func expectsContinue(r *http.Request) bool {
+	for _, v := range r.Header.Values("Expect") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "100-continue") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func tooLarge(r *http.Request) *Error {
+	if r.ContentLength > 10 {
+		return &Error{
+			Title:      "Request body too large",
+			Id:         "body_too_large",
+			Instance:   r.URL.Path,
+			StatusCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	return nil
+}
+
+func TestExpectContinueRejects(t *testing.T) {
+	h := ExpectContinueMiddleware(okHandler, tooLarge)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/uploads", strings.NewReader(strings.Repeat("a", 20)))
+	req.Header.Set("Expect", "100-Continue")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusRequestEntityTooLarge)
+	test.AssertContains(t, w.Body.String(), "body_too_large")
+
+	// Without the header, the precheck doesn't run.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/uploads", strings.NewReader(strings.Repeat("a", 20)))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestExpectContinueSendsContinue(t *testing.T) {
+	h := ExpectContinueMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 5)
+		n, _ := r.Body.Read(buf)
+		w.Write(buf[:n])
+	}), tooLarge)
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	for _, tt := range []struct {
+		body   string
+		status string
+	}{
+		{"hello", "HTTP/1.1 100 Continue"},
+		{strings.Repeat("a", 20), "HTTP/1.1 413 Request Entity Too Large"},
+	} {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		test.AssertNotError(t, err, "")
+		// With Connection: close, the server doesn't linger on the
+		// connection after rejecting the unread body.
+		fmt.Fprintf(conn, "POST /v1/uploads HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\nExpect: 100-continue\r\nContent-Length: %d\r\n\r\n", len(tt.body))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		test.AssertNotError(t, err, "")
+		test.AssertEquals(t, strings.TrimSpace(line), tt.status)
+		conn.Close()
+	}
+}
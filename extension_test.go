@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestExtensionContentType(t *testing.T) {
+	h := ExtensionContentTypeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, tt := range []struct {
+		path  string
+		ctype string
+	}{
+		{"/v1/reports/123.json", "application/json"},
+		{"/v1/reports/123.csv", "text/csv; charset=utf-8"},
+		{"/v1/reports/123.xml", "text/xml; charset=utf-8"},
+		{"/v1/reports/123.unknownext", ""},
+		{"/v1/reports/123", ""},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Header().Get("Content-Type"), tt.ctype)
+	}
+}
+
+func TestExtensionContentTypeOverride(t *testing.T) {
+	h := ExtensionContentTypeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/reports/123.json", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "text/plain")
+}
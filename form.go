@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxFormBytes is the largest form body FormToJSONMiddleware converts, the
+// same limit http.Request.ParseForm uses.
+const maxFormBytes = 10 << 20
+
+var errFormTooLarge = errors.New("the form body must be at most 10MB")
+
+// FormToJSONMiddleware converts application/x-www-form-urlencoded request
+// bodies to JSON before h is called, so handlers only need to decode JSON.
+// The form becomes a flat JSON object of strings; a key that appears more
+// than once becomes an array of strings. For example "name=kev&tag=a&tag=b"
+// becomes {"name": "kev", "tag": ["a", "b"]}. The Content-Type and
+// Content-Length headers are updated to match the new body.
+//
+// Requests with other content types are passed to h unchanged. A form body
+// that can't be parsed, or is larger than 10MB, gets a 400 error.
+func FormToJSONMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/x-www-form-urlencoded" || r.Body == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxFormBytes+1))
+		r.Body.Close()
+		var form url.Values
+		if err == nil && len(b) > maxFormBytes {
+			err = errFormTooLarge
+		}
+		if err == nil {
+			form, err = url.ParseQuery(string(b))
+		}
+		if err != nil {
+			WriteError(w, &Error{
+				Title:      "Invalid form body",
+				Id:         "invalid_form",
+				Detail:     err.Error(),
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		obj := make(map[string]interface{}, len(form))
+		for key, vals := range form {
+			if len(vals) == 1 {
+				obj[key] = vals[0]
+			} else {
+				obj[key] = vals
+			}
+		}
+		body, err := json.Marshal(obj)
+		if err != nil {
+			WriteError(w, new500(r))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		h.ServeHTTP(w, r)
+	})
+}
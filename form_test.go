@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestFormToJSON(t *testing.T) {
+	var got map[string]interface{}
+	var ctype string
+	h := FormToJSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctype = r.Header.Get("Content-Type")
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader("name=kev&tag=a&tag=b&empty="))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, ctype, "application/json")
+	test.AssertDeepEquals(t, got, map[string]interface{}{
+		"name":  "kev",
+		"tag":   []interface{}{"a", "b"},
+		"empty": "",
+	})
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"name":"kev"}`))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(w, req)
+	test.AssertDeepEquals(t, got, map[string]interface{}{"name": "kev"})
+}
+
+func TestFormToJSONInvalid(t *testing.T) {
+	h := FormToJSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader("name=%zz"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "invalid_form")
+}
@@ -0,0 +1,3 @@
+module github.com/Shyp/go-servers
+
+go 1.20
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// goroutineSettleDelay is how long GoroutineDeltaMiddleware waits after
+	// a handler returns before counting goroutines, so goroutines that are
+	// about to exit aren't counted as leaks.
+	goroutineSettleDelay = 100 * time.Millisecond
+	// goroutineLeakWindow is the number of consecutive requests to a route
+	// that must increase the goroutine count before a warning is logged.
+	goroutineLeakWindow = 10
+)
+
+var publishGoroutines sync.Once
+
+// routeLabel returns the pattern of the route that will serve, or has
+// served, r, or "unknown" if there isn't one.
+func routeLabel(h http.Handler, r *http.Request) string {
+	if pattern := MatchedPattern(r); pattern != "" {
+		return pattern
+	}
+	if rh, ok := h.(*RegexpHandler); ok {
+		if route := rh.matchRoute(r); route != nil {
+			return route.pattern.String()
+		}
+	}
+	return "unknown"
+}
+
+// goroutineSample is a goroutine count taken before a request, waiting to
+// be compared with the count after the request settles.
+type goroutineSample struct {
+	label  string
+	before int
+	due    time.Time
+}
+
+// GoroutineDeltaMiddleware helps find handlers that leak goroutines. It
+// counts goroutines before each request and again shortly after the handler
+// returns, and logs a warning naming the route if requests to the same route
+// increase the count 10 times in a row. Concurrent requests make the count
+// noisy, so treat a warning as a hint rather than proof.
+//
+// The counts after each request are taken by a single background goroutine,
+// started by the first request, so measuring doesn't add goroutines of its
+// own. If more than 1000 requests are waiting to be counted, new requests
+// aren't counted.
+//
+// The middleware is only active if the DEBUG_GOROUTINE_DELTA environment
+// variable is set to true; otherwise it calls h directly. The current number
+// of goroutines is published as the "goroutines" expvar either way.
+func GoroutineDeltaMiddleware(h http.Handler) http.Handler {
+	return goroutineDeltaMiddleware(h, goroutineSettleDelay, nil)
+}
+
+// goroutineDeltaMiddleware is GoroutineDeltaMiddleware with the settle
+// delay as a parameter. If sampled isn't nil, it's called after each
+// request's count is taken.
+func goroutineDeltaMiddleware(h http.Handler, settle time.Duration, sampled func()) http.Handler {
+	publishGoroutines.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() interface{} {
+			return runtime.NumGoroutine()
+		}))
+	})
+	pending := make(chan goroutineSample, 1000)
+	var startSampler sync.Once
+	sample := func() {
+		streaks := make(map[string]int)
+		for s := range pending {
+			time.Sleep(time.Until(s.due))
+			delta := runtime.NumGoroutine() - s.before
+			if delta <= 0 {
+				delete(streaks, s.label)
+			} else {
+				streaks[s.label]++
+				if streaks[s.label] >= goroutineLeakWindow {
+					log.Printf("server: possible goroutine leak: the last %d requests to %s each increased the goroutine count (now %d)", streaks[s.label], s.label, s.before+delta)
+					delete(streaks, s.label)
+				}
+			}
+			if sampled != nil {
+				sampled()
+			}
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if os.Getenv("DEBUG_GOROUTINE_DELTA") != "true" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		startSampler.Do(func() { go sample() })
+		label := routeLabel(h, r)
+		before := runtime.NumGoroutine()
+		h.ServeHTTP(w, r)
+		select {
+		case pending <- goroutineSample{label: label, before: before, due: time.Now().Add(settle)}:
+		default:
+		}
+	})
+}
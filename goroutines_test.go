@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestGoroutineDeltaPublishesExpvar(t *testing.T) {
+	h := GoroutineDeltaMiddleware(okHandler)
+	GoroutineDeltaMiddleware(okHandler)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.Assert(t, expvar.Get("goroutines") != nil, "expected goroutines expvar")
+}
+
+func TestRouteLabel(t *testing.T) {
+	h := new(RegexpHandler)
+	route := BuildRoute(`^/v1/jobs$`)
+	h.Handler(route, []string{"GET"}, okHandler)
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	test.AssertEquals(t, routeLabel(h, req), route.String())
+	req, _ = http.NewRequest("GET", "/v1/users", nil)
+	test.AssertEquals(t, routeLabel(h, req), "unknown")
+}
+
+// syncBuffer is a bytes.Buffer that's safe to write from the log package
+// while a test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// testSettleDelay replaces goroutineSettleDelay in tests. It's long enough
+// for the test handlers' goroutines to exit.
+const testSettleDelay = 5 * time.Millisecond
+
+func TestGoroutineDeltaConcurrentRequests(t *testing.T) {
+	t.Setenv("DEBUG_GOROUTINE_DELTA", "true")
+	var buf syncBuffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	const workers, requests = 4, 3 * goroutineLeakWindow
+	var samples sync.WaitGroup
+	samples.Add(workers * requests)
+	rh := new(RegexpHandler)
+	rh.Handler(BuildRoute(`^/v1/jobs$`), []string{"GET"}, okHandler)
+	h := goroutineDeltaMiddleware(rh, testSettleDelay, samples.Done)
+	// Like connections to a server, each worker sends requests one after
+	// another, several of them within the settle delay.
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requests; j++ {
+				req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+				h.ServeHTTP(httptest.NewRecorder(), req)
+				time.Sleep(testSettleDelay / 5)
+			}
+		}()
+	}
+	wg.Wait()
+	samples.Wait()
+	test.AssertEquals(t, buf.String(), "")
+}
+
+func TestGoroutineDeltaLeak(t *testing.T) {
+	t.Setenv("DEBUG_GOROUTINE_DELTA", "true")
+	var buf syncBuffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	var samples sync.WaitGroup
+	samples.Add(goroutineLeakWindow)
+	rh := new(RegexpHandler)
+	rh.HandleFunc(BuildRoute(`^/v1/leaky$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		go func() { <-stop }()
+	})
+	h := goroutineDeltaMiddleware(rh, testSettleDelay, samples.Done)
+	for i := 0; i < goroutineLeakWindow; i++ {
+		req, _ := http.NewRequest("GET", "/v1/leaky", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	samples.Wait()
+	test.AssertContains(t, buf.String(), `possible goroutine leak: the last 10 requests to ^/v1/leaky$`)
+}
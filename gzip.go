@@ -0,0 +1,198 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// codingQuality returns the quality value the Accept-Encoding header gives
+// to coding, and whether the coding is named explicitly. If it isn't, the
+// quality of "*" is returned, or 0 if there's no "*".
+func codingQuality(header, coding string) (float64, bool) {
+	wildcard := 0.0
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(strings.TrimSpace(kv[0])) == "q" {
+				f, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+				if err != nil || f < 0 {
+					f = 0
+				}
+				q = f
+			}
+		}
+		if name == coding || (coding == "gzip" && name == "x-gzip") {
+			return q, true
+		}
+		if name == "*" {
+			wildcard = q
+		}
+	}
+	return wildcard, false
+}
+
+// acceptsGzip reports whether a response should be gzipped for a client that
+// sent the given Accept-Encoding header. Following RFC 7231, gzip must have a
+// positive quality, either by name or through "*", and is not used if the
+// client explicitly gives the identity (uncompressed) encoding a higher
+// quality. An empty header means the client only accepts identity.
+func acceptsGzip(header string) bool {
+	if strings.TrimSpace(header) == "" {
+		return false
+	}
+	gzipQ, _ := codingQuality(header, "gzip")
+	if gzipQ <= 0 {
+		return false
+	}
+	// Only an explicit preference for identity outranks gzip; "*" doesn't.
+	if identityQ, explicit := codingQuality(header, "identity"); explicit {
+		return gzipQ >= identityQ
+	}
+	return true
+}
+
+type gzipWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		// Informational responses like 103 Early Hints come before the
+		// real response, which may still be compressed.
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if h.Get("Content-Encoding") == "" && bodyAllowed(code) && w.r.Method != "HEAD" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			// Sniff the uncompressed content, not the gzipped bytes.
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// GzipMiddleware compresses responses with gzip for clients that accept it.
+// The Accept-Encoding header is parsed with its quality values, so clients
+// that send "gzip;q=0", or refuse every encoding with "*;q=0", get an
+// uncompressed response. Responses that already have a Content-Encoding are
+// not compressed again.
+//
+// Every response gets a "Vary: Accept-Encoding" header, whether or not it's
+// compressed, so caches don't serve an uncompressed copy to clients that
+// accept gzip, or a compressed one to clients that don't.
+func GzipMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w, r: r}
+		defer gw.close()
+		h.ServeHTTP(gw, r)
+	})
+}
+
+// DefaultMaxDecompressedBytes is the largest request body, after
+// decompression, that DecompressRequestMiddleware allows.
+const DefaultMaxDecompressedBytes = 10 << 20
+
+// gzipBody closes both the gzip reader and the original request body.
+type gzipBody struct {
+	io.Reader
+	gz   *gzip.Reader
+	body io.Closer
+}
+
+func (b *gzipBody) Close() error {
+	b.gz.Close()
+	return b.body.Close()
+}
+
+// DecompressRequestMiddleware decompresses request bodies sent with
+// "Content-Encoding: gzip", so handlers can read them like any other body.
+// The Content-Encoding and Content-Length headers are removed, since they
+// describe the compressed body. A body that doesn't start with a valid gzip
+// header gets a 400 error; if the compressed data is corrupt further in,
+// the handler gets the error when it reads the body.
+//
+// To protect against small bodies that decompress to huge ones, reading
+// more than DefaultMaxDecompressedBytes of decompressed data fails with an
+// *http.MaxBytesError, as if the body were limited with MaxBodyBytes.
+// Requests with other encodings are passed to h unchanged.
+func DecompressRequestMiddleware(h http.Handler) http.Handler {
+	return DecompressRequestMiddlewareWithLimit(h, DefaultMaxDecompressedBytes)
+}
+
+// DecompressRequestMiddlewareWithLimit is like DecompressRequestMiddleware,
+// but allows at most max bytes of decompressed data.
+func DecompressRequestMiddlewareWithLimit(h http.Handler, max int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if (coding != "gzip" && coding != "x-gzip") || r.Body == nil || r.Body == http.NoBody {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			WriteError(w, &Error{
+				Title:      "Invalid content encoding",
+				Id:         "invalid_encoding",
+				Detail:     "The request body is not valid gzip",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, &gzipBody{Reader: gz, gz: gz, body: r.Body}, max)
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+var acceptsGzipTests = []struct {
+	header string
+	want   bool
+}{
+	{"", false},
+	{"gzip", true},
+	{"gzip, deflate", true},
+	{"x-gzip", true},
+	{"*", true},
+	{"gzip;q=0", false},
+	{"gzip;q=0, *", false},
+	{"*;q=0", false},
+	{"identity;q=0, *;q=0", false},
+	{"identity", false},
+	{"deflate", false},
+	{"identity;q=1, gzip;q=0.5", false},
+	{"identity;q=0.5, gzip;q=1", true},
+	{"identity;q=0, gzip;q=0.1", true},
+	{"GZIP; Q=0.8", true},
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for _, tt := range acceptsGzipTests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q): got %t, want %t", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	h := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"hello": "world"}`))
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Content-Encoding"), "gzip")
+	test.AssertEquals(t, w.Header().Get("Vary"), "Accept-Encoding")
+	gz, err := gzip.NewReader(w.Body)
+	test.AssertNotError(t, err, "reading gzip body")
+	body, err := io.ReadAll(gz)
+	test.AssertNotError(t, err, "reading gzip body")
+	test.AssertEquals(t, string(body), `{"hello": "world"}`)
+
+	w = httptest.NewRecorder()
+	req.Header.Set("Accept-Encoding", "gzip;q=0")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Content-Encoding"), "")
+	test.AssertEquals(t, w.Header().Get("Vary"), "Accept-Encoding")
+	test.AssertEquals(t, w.Body.String(), `{"hello": "world"}`)
+
+	w = httptest.NewRecorder()
+	req.Header.Del("Accept-Encoding")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Content-Encoding"), "")
+	test.AssertDeepEquals(t, w.Header().Values("Vary"), []string{"Accept-Encoding"})
+}
+
+func TestGzipMiddlewareEarlyHints(t *testing.T) {
+	h := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</app.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html></html>"))
+	}))
+	// A ResponseRecorder treats the 103 as the final status, so use a real
+	// server.
+	s := httptest.NewServer(h)
+	defer s.Close()
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	test.AssertNotError(t, err, "making request")
+	defer resp.Body.Close()
+	test.AssertEquals(t, resp.StatusCode, http.StatusOK)
+	test.AssertEquals(t, resp.Header.Get("Content-Encoding"), "gzip")
+	gz, err := gzip.NewReader(resp.Body)
+	test.AssertNotError(t, err, "reading gzip body")
+	body, err := io.ReadAll(gz)
+	test.AssertNotError(t, err, "reading gzip body")
+	test.AssertEquals(t, string(body), "<html></html>")
+}
+
+func gzipBytes(s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	var body, encoding string
+	h := DecompressRequestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		encoding = r.Header.Get("Content-Encoding")
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", bytes.NewReader(gzipBytes(`{"name":"job"}`)))
+	req.Header.Set("Content-Encoding", "gzip")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, body, `{"name":"job"}`)
+	test.AssertEquals(t, encoding, "")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"name":"job"}`))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, body, `{"name":"job"}`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"name":"job"}`))
+	req.Header.Set("Content-Encoding", "gzip")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "invalid_encoding")
+}
+
+func TestDecompressRequestLimit(t *testing.T) {
+	var err error
+	h := DecompressRequestMiddlewareWithLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err = io.ReadAll(r.Body)
+	}), 1024)
+	req, _ := http.NewRequest("POST", "/v1/jobs", bytes.NewReader(gzipBytes(strings.Repeat("a", 1<<20))))
+	req.Header.Set("Content-Encoding", "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	var maxErr *http.MaxBytesError
+	test.Assert(t, errors.As(err, &maxErr), "expected a MaxBytesError")
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RequireHeaderMiddleware returns a 400 error if the request does not
+// include the given header, or the header is empty.
+func RequireHeaderMiddleware(h http.Handler, header string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimSpace(r.Header.Get(header)) == "" {
+			WriteError(w, newMissingHeader(r, header))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RequireHeaderValueMiddleware returns a 400 error unless the request's
+// header is equal to value.
+func RequireHeaderValueMiddleware(h http.Handler, header, value string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimSpace(r.Header.Get(header))
+		if got == "" {
+			WriteError(w, newMissingHeader(r, header))
+			return
+		}
+		if got != value {
+			WriteError(w, &Error{
+				Title:      "Invalid header",
+				Id:         "invalid_header",
+				Detail:     fmt.Sprintf("The %s header must be %q", header, value),
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newMissingHeader(r *http.Request, header string) *Error {
+	return &Error{
+		Title:      "Missing required header",
+		Id:         "missing_header",
+		Detail:     fmt.Sprintf("The %s header is required", header),
+		Instance:   r.URL.Path,
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+// VersionHeaderMiddleware sets the X-Server-Version header on every
+// response to version, for example a git commit hash set at build time, to
+// show which build served a request. The header is set before h is called,
+// so it's sent however h writes the response. If version is empty, h is
+// returned unchanged.
+func VersionHeaderMiddleware(h http.Handler, version string) http.Handler {
+	if version == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Server-Version", version)
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestRequireHeader(t *testing.T) {
+	h := RequireHeaderMiddleware(okHandler, "X-API-Version")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "missing_header")
+	test.AssertContains(t, w.Body.String(), "X-API-Version")
+
+	w = httptest.NewRecorder()
+	req.Header.Set("X-API-Version", "2016-05-01")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestRequireHeaderValue(t *testing.T) {
+	h := RequireHeaderValueMiddleware(okHandler, "X-API-Version", "2")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	req.Header.Set("X-API-Version", "1")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "invalid_header")
+
+	w = httptest.NewRecorder()
+	req.Header.Set("X-API-Version", "2")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestVersionHeader(t *testing.T) {
+	h := VersionHeaderMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}), "abc123")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusAccepted)
+	test.AssertEquals(t, w.Header().Get("X-Server-Version"), "abc123")
+
+	w = httptest.NewRecorder()
+	VersionHeaderMiddleware(okHandler, "").ServeHTTP(w, req)
+	_, ok := w.Header()["X-Server-Version"]
+	test.Assert(t, !ok, "expected no version header")
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SetHostMiddleware sets the request's Host, and the host in its URL, to
+// host before calling h, for example so a reverse proxy sends the Host a
+// backend expects. The host the client requested is still available from
+// OriginalHost, for handlers that build absolute URLs for the client.
+func SetHostMiddleware(h http.Handler, host string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		original := OriginalHost(r)
+		r2 := r.WithContext(context.WithValue(r.Context(), originalHostKey, original))
+		u := *r.URL
+		u.Host = host
+		r2.URL = &u
+		r2.Host = host
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// OriginalHost returns the Host the client sent, before any
+// SetHostMiddleware replaced it. For requests that didn't pass through
+// SetHostMiddleware, it returns r.Host.
+func OriginalHost(r *http.Request) string {
+	if host, ok := r.Context().Value(originalHostKey).(string); ok {
+		return host
+	}
+	return r.Host
+}
+
+// splitHost splits a Host header into the host name, without brackets for
+// IPv6 addresses, and the port, which may be empty.
+func splitHost(hostport string) (string, string) {
+	if host, port, err := net.SplitHostPort(hostport); err == nil {
+		return host, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]"), ""
+}
+
+// CanonicalHostMiddleware makes sure requests are for the canonical host
+// name, for example "example.com" rather than "www.example.com". The Host of
+// each request, without its port, is compared case insensitively to
+// canonical. If they're different and redirect is true, the client gets a
+// 301 redirect to the same path and query on the canonical host, keeping the
+// port; if redirect is false, it gets a 421 error. IPv6 hosts are written
+// without brackets, like "::1".
+//
+// The redirect uses https if the request came over TLS, and http otherwise.
+// Behind a load balancer that terminates TLS, every request arrives over
+// plain HTTP, so give canonical with the scheme, like "https://example.com",
+// to redirect to that scheme instead. The redirect then goes to the host as
+// written in canonical, including its port if it has one, rather than
+// keeping the port of the request, which is usually the load balancer's
+// backend port. IPv6 hosts in a URL need brackets, like "https://[::1]".
+func CanonicalHostMiddleware(h http.Handler, canonical string, redirect bool) http.Handler {
+	canonical = strings.ToLower(canonical)
+	var scheme, canonicalPort string
+	if i := strings.Index(canonical, "://"); i >= 0 {
+		scheme = canonical[:i]
+		canonical, canonicalPort = splitHost(strings.TrimSuffix(canonical[i+len("://"):], "/"))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port := splitHost(r.Host)
+		if strings.ToLower(host) == canonical {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !redirect {
+			WriteError(w, &Error{
+				Title:      "Wrong host",
+				Id:         "wrong_host",
+				Detail:     fmt.Sprintf("This server only serves requests for %s", canonical),
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusMisdirectedRequest,
+			})
+			return
+		}
+		u := url.URL{Scheme: "http", Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+		if scheme != "" {
+			u.Scheme = scheme
+			port = canonicalPort
+		}
+		u.Host = canonical
+		if strings.Contains(canonical, ":") {
+			u.Host = "[" + canonical + "]"
+		}
+		if port != "" {
+			u.Host = net.JoinHostPort(canonical, port)
+		}
+		Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestSetHostMiddleware(t *testing.T) {
+	var host, urlHost, original string
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		urlHost = r.URL.Host
+		original = OriginalHost(r)
+	})
+	h := SetHostMiddleware(SetHostMiddleware(inner, "backend.internal"), "other.internal")
+	req, _ := http.NewRequest("GET", "https://api.example.com/v1/jobs", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertEquals(t, host, "backend.internal")
+	test.AssertEquals(t, urlHost, "backend.internal")
+	test.AssertEquals(t, original, "api.example.com")
+	test.AssertEquals(t, req.Host, "api.example.com")
+	test.AssertEquals(t, req.URL.Host, "api.example.com")
+
+	test.AssertEquals(t, OriginalHost(req), "api.example.com")
+}
+
+func TestCanonicalHostRedirect(t *testing.T) {
+	h := CanonicalHostMiddleware(okHandler, "example.com", true)
+	for _, tt := range []struct {
+		host     string
+		code     int
+		location string
+	}{
+		{"example.com", 200, ""},
+		{"EXAMPLE.com:8080", 200, ""},
+		{"www.example.com", 301, "http://example.com/v1/jobs?limit=10"},
+		{"www.example.com:8080", 301, "http://example.com:8080/v1/jobs?limit=10"},
+		{"[::1]:8080", 301, "http://example.com:8080/v1/jobs?limit=10"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs?limit=10", nil)
+		req.Host = tt.host
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		test.AssertEquals(t, w.Header().Get("Location"), tt.location)
+	}
+}
+
+func TestCanonicalHostReject(t *testing.T) {
+	h := CanonicalHostMiddleware(okHandler, "::1", false)
+	for _, tt := range []struct {
+		host string
+		code int
+	}{
+		{"[::1]:8080", 200},
+		{"[::1]", 200},
+		{"[::2]:8080", 421},
+		{"example.com", 421},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+		req.Host = tt.host
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		if tt.code == 421 {
+			test.AssertErrorResponse(t, w, 421, "wrong_host")
+		}
+	}
+
+	h = CanonicalHostMiddleware(okHandler, "::1", true)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	req.Host = "localhost"
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Location"), "http://[::1]/v1/jobs")
+}
+
+func TestCanonicalHostRedirectScheme(t *testing.T) {
+	for _, tt := range []struct {
+		canonical string
+		host      string
+		location  string
+	}{
+		{"https://example.com", "www.example.com", "https://example.com/v1/jobs?limit=10"},
+		{"https://example.com/", "www.example.com:8080", "https://example.com/v1/jobs?limit=10"},
+		{"https://example.com:8443", "www.example.com:8080", "https://example.com:8443/v1/jobs?limit=10"},
+		{"https://[::1]", "localhost", "https://[::1]/v1/jobs?limit=10"},
+	} {
+		h := CanonicalHostMiddleware(okHandler, tt.canonical, true)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs?limit=10", nil)
+		req.Host = tt.host
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusMovedPermanently)
+		test.AssertEquals(t, w.Header().Get("Location"), tt.location)
+	}
+
+	// The host, without the scheme, is still what requests are compared to.
+	h := CanonicalHostMiddleware(okHandler, "https://example.com", true)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	req.Host = "example.com:8080"
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
@@ -0,0 +1,97 @@
+// Package jsonschema validates request bodies against a JSON Schema before
+// they reach a handler. It lives in its own package so the core server
+// package doesn't depend on a schema library.
+package jsonschema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Shyp/go-servers"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// JSONSchemaMiddleware validates each request body against schema, and
+// returns a 400 error if it doesn't conform. The error's Errors field has an
+// entry for each problem, with the offending field in Instance. Valid bodies
+// are restored so h can decode them.
+//
+// The body is read into memory to validate it, so bodies larger than
+// server.MaxBufferedBodyBytes get a 413 error.
+//
+// The schema is compiled once, when JSONSchemaMiddleware is called; like
+// regexp.MustCompile, it panics if the schema is invalid.
+func JSONSchemaMiddleware(h http.Handler, schema []byte) http.Handler {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+	if err != nil {
+		panic(fmt.Sprintf("jsonschema: invalid schema: %v", err))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > server.MaxBufferedBodyBytes {
+			server.WriteError(w, newRequestTooLarge(r))
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, server.MaxBufferedBodyBytes))
+		r.Body.Close()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			server.WriteError(w, newRequestTooLarge(r))
+			return
+		}
+		if err != nil {
+			server.WriteError(w, &server.Error{
+				Title:      "Could not read request body",
+				Id:         "invalid_body",
+				Detail:     err.Error(),
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		result, err := compiled.Validate(gojsonschema.NewBytesLoader(body))
+		if err != nil {
+			server.WriteError(w, &server.Error{
+				Title:      "Invalid JSON",
+				Id:         "invalid_json",
+				Detail:     "The request body could not be parsed as JSON",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		if !result.Valid() {
+			errs := make([]server.Error, len(result.Errors()))
+			for i, re := range result.Errors() {
+				errs[i] = server.Error{
+					Title:    "Invalid field",
+					Id:       re.Type(),
+					Detail:   re.Description(),
+					Instance: re.Field(),
+				}
+			}
+			server.WriteError(w, &server.Error{
+				Title:      "Request body does not match the schema",
+				Id:         "schema_validation",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+				Errors:     errs,
+			})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newRequestTooLarge(r *http.Request) *server.Error {
+	return &server.Error{
+		Title:      "Request body too large",
+		Id:         "request_too_large",
+		Detail:     fmt.Sprintf("The request body must be at most %d bytes", server.MaxBufferedBodyBytes),
+		Instance:   r.URL.Path,
+		StatusCode: http.StatusRequestEntityTooLarge,
+	}
+}
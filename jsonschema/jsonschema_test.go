@@ -0,0 +1,68 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers"
+	"github.com/Shyp/go-servers/test"
+)
+
+var jobSchema = []byte(`{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"priority": {"type": "integer"}
+	},
+	"required": ["name"]
+}`)
+
+func TestJSONSchemaMiddleware(t *testing.T) {
+	var got string
+	h := JSONSchemaMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}), jobSchema)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"name": "job"}`))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, got, `{"name": "job"}`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"priority": "high"}`))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	var e server.Error
+	err := json.Unmarshal(w.Body.Bytes(), &e)
+	test.AssertNotError(t, err, "decoding error")
+	test.AssertEquals(t, e.Id, "schema_validation")
+	test.AssertEquals(t, len(e.Errors), 2)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"name": `))
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "invalid_json")
+}
+
+func TestJSONSchemaMiddlewareBodyTooLarge(t *testing.T) {
+	h := JSONSchemaMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}), jobSchema)
+	body := `{"name": "` + strings.Repeat("a", server.MaxBufferedBodyBytes) + `"}`
+	for _, contentLength := range []bool{true, false} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(body))
+		if !contentLength {
+			req.ContentLength = -1
+		}
+		h.ServeHTTP(w, req)
+		test.AssertErrorResponse(t, w, http.StatusRequestEntityTooLarge, "request_too_large")
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// LastModifiedMiddleware adds support for If-Modified-Since requests to h.
+// For GET and HEAD requests, modTimeFn returns the time the requested
+// resource last changed, which is sent in the Last-Modified header. If the
+// request's If-Modified-Since header is at or after that time, compared at
+// one second precision like the header, a 304 Not Modified is returned
+// without calling h.
+//
+// If modTimeFn returns false, for example because the resource doesn't
+// exist, the request is passed to h unchanged. If-Modified-Since is ignored
+// for requests with an If-None-Match header, as RFC 7232 requires.
+func LastModifiedMiddleware(h http.Handler, modTimeFn func(*http.Request) (time.Time, bool)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		modTime, ok := modTimeFn(r)
+		if !ok || modTime.IsZero() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		modTime = modTime.Truncate(time.Second)
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+		if ims := r.Header.Get("If-Modified-Since"); ims != "" && r.Header.Get("If-None-Match") == "" {
+			if t, err := http.ParseTime(ims); err == nil && !modTime.After(t) {
+				w.Header().Del("Content-Type")
+				w.Header().Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestLastModifiedMiddleware(t *testing.T) {
+	modTime := time.Date(2026, 3, 1, 12, 0, 0, 500e6, time.UTC)
+	h := LastModifiedMiddleware(okHandler, func(r *http.Request) (time.Time, bool) {
+		if r.URL.Path == "/v1/missing" {
+			return time.Time{}, false
+		}
+		return modTime, true
+	})
+	for _, tt := range []struct {
+		method  string
+		path    string
+		ims     string
+		inm     string
+		code    int
+		lastMod string
+	}{
+		{"GET", "/v1/jobs", "", "", 200, "Sun, 01 Mar 2026 12:00:00 GMT"},
+		{"GET", "/v1/jobs", "Sun, 01 Mar 2026 12:00:00 GMT", "", 304, "Sun, 01 Mar 2026 12:00:00 GMT"},
+		{"HEAD", "/v1/jobs", "Mon, 02 Mar 2026 12:00:00 GMT", "", 304, "Sun, 01 Mar 2026 12:00:00 GMT"},
+		{"GET", "/v1/jobs", "Sun, 01 Mar 2026 11:59:59 GMT", "", 200, "Sun, 01 Mar 2026 12:00:00 GMT"},
+		{"GET", "/v1/jobs", "not a date", "", 200, "Sun, 01 Mar 2026 12:00:00 GMT"},
+		{"GET", "/v1/jobs", "Sun, 01 Mar 2026 12:00:00 GMT", `"abc"`, 200, "Sun, 01 Mar 2026 12:00:00 GMT"},
+		{"GET", "/v1/missing", "Sun, 01 Mar 2026 12:00:00 GMT", "", 200, ""},
+		{"POST", "/v1/jobs", "Sun, 01 Mar 2026 12:00:00 GMT", "", 200, ""},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		if tt.ims != "" {
+			req.Header.Set("If-Modified-Since", tt.ims)
+		}
+		if tt.inm != "" {
+			req.Header.Set("If-None-Match", tt.inm)
+		}
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		test.AssertEquals(t, w.Header().Get("Last-Modified"), tt.lastMod)
+		if tt.code == 304 {
+			test.AssertEquals(t, w.Body.Len(), 0)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencySamples is the number of recent requests LatencyMiddleware
+// computes percentiles over.
+const DefaultLatencySamples = 1000
+
+// latencyRing holds the durations of the most recent requests.
+type latencyRing struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyRing(size int) *latencyRing {
+	if size <= 0 {
+		size = DefaultLatencySamples
+	}
+	return &latencyRing{samples: make([]time.Duration, size)}
+}
+
+func (l *latencyRing) add(d time.Duration) {
+	l.mu.Lock()
+	l.samples[l.next] = d
+	l.next++
+	if l.next == len(l.samples) {
+		l.next = 0
+		l.full = true
+	}
+	l.mu.Unlock()
+}
+
+// percentiles returns the number of samples, and the p50, p90 and p99
+// latencies in milliseconds.
+func (l *latencyRing) percentiles() map[string]interface{} {
+	l.mu.Lock()
+	n := l.next
+	if l.full {
+		n = len(l.samples)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, l.samples[:n])
+	l.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	result := map[string]interface{}{"count": n}
+	for _, p := range []struct {
+		name string
+		pct  int
+	}{{"p50", 50}, {"p90", 90}, {"p99", 99}} {
+		if n == 0 {
+			result[p.name] = 0.0
+			continue
+		}
+		idx := (n*p.pct+99)/100 - 1
+		if idx < 0 {
+			idx = 0
+		}
+		result[p.name] = float64(sorted[idx]) / float64(time.Millisecond)
+	}
+	return result
+}
+
+// LatencyMiddleware records how long h takes to serve each request, and
+// publishes the p50, p90 and p99 latencies (in milliseconds) over the last
+// DefaultLatencySamples requests as an expvar with the given name, so they
+// appear at /debug/vars. Like expvar.Publish, it panics if name is already
+// in use.
+func LatencyMiddleware(h http.Handler, name string) http.Handler {
+	return LatencyMiddlewareWithSize(h, name, DefaultLatencySamples)
+}
+
+// LatencyMiddlewareWithSize is like LatencyMiddleware, but computes the
+// percentiles over the last size requests.
+func LatencyMiddlewareWithSize(h http.Handler, name string, size int) http.Handler {
+	ring := newLatencyRing(size)
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return ring.percentiles()
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		defer func() {
+			ring.add(time.Since(start))
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
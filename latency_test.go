@@ -0,0 +1,45 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestLatencyRingPercentiles(t *testing.T) {
+	ring := newLatencyRing(100)
+	for i := 1; i <= 150; i++ {
+		ring.add(time.Duration(i) * time.Millisecond)
+	}
+	p := ring.percentiles()
+	// Only the last 100 samples (51ms to 150ms) should be kept.
+	test.AssertEquals(t, p["count"], 100)
+	test.AssertEquals(t, p["p50"], 100.0)
+	test.AssertEquals(t, p["p90"], 140.0)
+	test.AssertEquals(t, p["p99"], 149.0)
+}
+
+var expvarNames atomic.Int64
+
+// uniqueExpvarName returns a new expvar name starting with prefix, since
+// expvars can't be published twice, and tests may run more than once.
+func uniqueExpvarName(prefix string) string {
+	return prefix + "_" + strconv.FormatInt(expvarNames.Add(1), 10)
+}
+
+func TestLatencyMiddlewarePublishesExpvar(t *testing.T) {
+	name := uniqueExpvarName("test_latency")
+	h := LatencyMiddleware(okHandler, name)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(w, req)
+	v := expvar.Get(name)
+	test.Assert(t, v != nil, "expected expvar to be published")
+	test.AssertContains(t, v.String(), `"count":1`)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxURLLengthMiddleware returns a 414 error for requests whose URI (the
+// path and query string, as sent by the client) is longer than maxLen bytes.
+// Place it before the RegexpHandler so pathologically long paths are
+// rejected before any patterns are evaluated.
+func MaxURLLengthMiddleware(h http.Handler, maxLen int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uri := r.RequestURI
+		if uri == "" {
+			uri = r.URL.RequestURI()
+		}
+		if len(uri) > maxLen {
+			WriteError(w, &Error{
+				Title:      "URI too long",
+				Id:         "uri_too_long",
+				Detail:     fmt.Sprintf("The request URI must be at most %d bytes long", maxLen),
+				StatusCode: http.StatusRequestURITooLong,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// validPath reports whether path is valid UTF-8 without control characters.
+func validPath(path string) bool {
+	if !utf8.ValidString(path) {
+		return false
+	}
+	for _, c := range path {
+		if unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidPathMiddleware returns a 400 error for requests whose decoded path
+// isn't valid UTF-8, or contains a control character: U+0000 to U+001F
+// (including tab, newline and NUL), U+007F (DEL), or U+0080 to U+009F.
+// Place it before the RegexpHandler so route patterns and handlers only see
+// well-formed paths. Paths with malformed percent-encoding are already
+// rejected by net/http before they reach any handler.
+func ValidPathMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validPath(r.URL.Path) {
+			WriteError(w, &Error{
+				Title:      "Invalid path",
+				Id:         "invalid_path",
+				Detail:     "The request path must be valid UTF-8 and must not contain control characters",
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// MaxQueryParamsMiddleware returns a 400 error for requests with more than
+// max query parameters. The parameters are counted by scanning the raw query
+// string for "&" separators, before it's parsed, so a request with thousands
+// of parameters is rejected without building a map of them.
+func MaxQueryParamsMiddleware(h http.Handler, max int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if raw := r.URL.RawQuery; raw != "" && strings.Count(raw, "&")+1 > max {
+			WriteError(w, &Error{
+				Title:      "Too many query parameters",
+				Id:         "too_many_parameters",
+				Detail:     fmt.Sprintf("The request may have at most %d query parameters", max),
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestMaxURLLength(t *testing.T) {
+	h := MaxURLLengthMiddleware(okHandler, 20)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs?limit=10", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/jobs/"+strings.Repeat("a", 20), nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusRequestURITooLong)
+	test.AssertContains(t, w.Body.String(), "uri_too_long")
+}
+
+func TestValidPath(t *testing.T) {
+	h := ValidPathMiddleware(okHandler)
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/v1/jobs", 200},
+		{"/v1/users/Zoë", 200},
+		{"/v1/jobs%2Fabc", 200},
+		{"/v1/jobs%00", 400},
+		{"/v1/jobs%0a", 400},
+		{"/v1/jobs%7f", 400},
+		{"/v1/jobs%ff", 400},
+		{"/v1/jobs%c2%85", 400},
+	} {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", tt.path, nil)
+		test.AssertNotError(t, err, "")
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		if tt.code == 400 {
+			test.AssertContains(t, w.Body.String(), "invalid_path")
+		}
+	}
+}
+
+func TestMaxQueryParams(t *testing.T) {
+	h := MaxQueryParamsMiddleware(okHandler, 3)
+	for _, tt := range []struct {
+		query string
+		code  int
+	}{
+		{"", 200},
+		{"a=1", 200},
+		{"a=1&b=2&c=3", 200},
+		{"a=1&b=2&c=3&d=4", 400},
+		{strings.Repeat("a=1&", 1000), 400},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs?"+tt.query, nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		if tt.code == 400 {
+			test.AssertContains(t, w.Body.String(), "too_many_parameters")
+		}
+	}
+}
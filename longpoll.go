@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// LongPoll waits up to timeout for wait to return, and writes the result to
+// w. wait is passed a context that's cancelled when the timeout expires or
+// the client disconnects, and should return as soon as it's done.
+//
+//   - If wait returns data, it's written as JSON with a 200 status.
+//   - If the timeout expires first, LongPoll writes a 204 No Content, and the
+//     client should poll again.
+//   - If wait returns an error before the timeout expires, even
+//     context.DeadlineExceeded, LongPoll writes a 500 error.
+//   - If the client disconnects, nothing is written.
+func LongPoll(w http.ResponseWriter, r *http.Request, wait func(ctx context.Context) (interface{}, error), timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	type result struct {
+		data interface{}
+		err  error
+	}
+	// Buffered so the goroutine can exit if we stop listening.
+	results := make(chan result, 1)
+	go func() {
+		data, err := wait(ctx)
+		results <- result{data, err}
+	}()
+	var res result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+	if res.err != nil {
+		if r.Context().Err() != nil {
+			// The client went away; there's nobody to respond to.
+			return
+		}
+		// wait may time out on its own, say on a database query; only
+		// our timeout means there's nothing to send yet.
+		if errors.Is(res.err, context.DeadlineExceeded) && ctx.Err() == context.DeadlineExceeded {
+			NoContent(w)
+			return
+		}
+		e := new500(r)
+		e.Detail = res.err.Error()
+		WriteError(w, e)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res.data)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestLongPoll(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v1/events", nil)
+
+	w := httptest.NewRecorder()
+	LongPoll(w, req, func(ctx context.Context) (interface{}, error) {
+		return map[string]string{"event": "job.created"}, nil
+	}, time.Second)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Body.String(), "{\"event\":\"job.created\"}\n")
+
+	w = httptest.NewRecorder()
+	LongPoll(w, req, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, 10*time.Millisecond)
+	test.AssertEquals(t, w.Code, http.StatusNoContent)
+
+	w = httptest.NewRecorder()
+	LongPoll(w, req, func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("database unavailable")
+	}, time.Second)
+	test.AssertEquals(t, w.Code, http.StatusInternalServerError)
+	test.AssertContains(t, w.Body.String(), "server_error")
+
+	w = httptest.NewRecorder()
+	LongPoll(w, req, func(ctx context.Context) (interface{}, error) {
+		// A query in wait with its own, shorter timeout.
+		return nil, context.DeadlineExceeded
+	}, time.Second)
+	test.AssertEquals(t, w.Code, http.StatusInternalServerError)
+}
+
+func TestLongPollClientGone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest("GET", "/v1/events", nil)
+	req = req.WithContext(ctx)
+	w := httptest.NewRecorder()
+	LongPoll(w, req, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, time.Second)
+	test.AssertEquals(t, w.Body.Len(), 0)
+}
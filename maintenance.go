@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaintenanceRetryAfter is how long MaintenanceMiddleware tells
+// clients to wait before trying again.
+const DefaultMaintenanceRetryAfter = 5 * time.Minute
+
+// MaintenanceMiddleware returns a 503 error with a Retry-After header of
+// DefaultMaintenanceRetryAfter for every request while enabled is true,
+// except requests for one of allowPaths, like "/healthz", which are passed
+// to h. Paths must match exactly. Flip enabled, for example from an admin
+// endpoint or a signal handler, to start or end maintenance without a
+// deploy.
+func MaintenanceMiddleware(h http.Handler, enabled *atomic.Bool, allowPaths []string) http.Handler {
+	return MaintenanceMiddlewareWithRetryAfter(h, enabled, allowPaths, DefaultMaintenanceRetryAfter)
+}
+
+// MaintenanceMiddlewareWithRetryAfter is like MaintenanceMiddleware, but
+// tells clients to wait retryAfter before trying again.
+func MaintenanceMiddlewareWithRetryAfter(h http.Handler, enabled *atomic.Bool, allowPaths []string, retryAfter time.Duration) http.Handler {
+	allowed := make(map[string]bool, len(allowPaths))
+	for _, path := range allowPaths {
+		allowed[path] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enabled.Load() && !allowed[r.URL.Path] {
+			WriteRetryAfter(w, http.StatusServiceUnavailable, retryAfter, &Error{
+				Title:    "Down for maintenance",
+				Id:       "maintenance",
+				Detail:   "The API is down for scheduled maintenance. Please try again later",
+				Instance: r.URL.Path,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestMaintenance(t *testing.T) {
+	var enabled atomic.Bool
+	h := MaintenanceMiddleware(okHandler, &enabled, []string{"/healthz"})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+
+	enabled.Store(true)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertErrorResponse(t, w, http.StatusServiceUnavailable, "maintenance")
+	test.AssertEquals(t, w.Header().Get("Retry-After"), "300")
+
+	for _, path := range []string{"/healthz", "/healthz/"} {
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(w, req)
+		if path == "/healthz" {
+			test.AssertEquals(t, w.Code, http.StatusOK)
+			test.AssertEquals(t, w.Body.String(), "ok")
+		} else {
+			test.AssertEquals(t, w.Code, http.StatusServiceUnavailable)
+		}
+	}
+
+	h = MaintenanceMiddlewareWithRetryAfter(okHandler, &enabled, nil, 30*time.Second)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Retry-After"), "30")
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMemorySampleInterval is how often MemoryGuardMiddleware reads the
+// heap size.
+const DefaultMemorySampleInterval = time.Second
+
+// MemoryGuardMiddleware sheds load when the process is close to running out
+// of memory: while the heap in use (runtime.MemStats.HeapInuse) is above
+// threshold bytes, requests get a 503 error with a Retry-After header instead
+// of being served.
+//
+// runtime.ReadMemStats is too expensive to call on every request, so the heap
+// size is sampled every DefaultMemorySampleInterval by a background
+// goroutine, which runs for the life of the process. Use
+// MemoryGuardMiddlewareWithInterval to stop it sooner.
+func MemoryGuardMiddleware(h http.Handler, threshold uint64) http.Handler {
+	return MemoryGuardMiddlewareWithInterval(context.Background(), h, threshold, DefaultMemorySampleInterval)
+}
+
+// MemoryGuardMiddlewareWithInterval is like MemoryGuardMiddleware, but
+// samples the heap size every interval, and stops sampling when ctx is done.
+// After that the last sample is used for every request.
+func MemoryGuardMiddlewareWithInterval(ctx context.Context, h http.Handler, threshold uint64, interval time.Duration) http.Handler {
+	return memoryGuardMiddleware(ctx, h, threshold, interval, nil)
+}
+
+// memoryGuardMiddleware is MemoryGuardMiddlewareWithInterval, calling
+// stopped, if it's not nil, when the sampling goroutine exits.
+func memoryGuardMiddleware(ctx context.Context, h http.Handler, threshold uint64, interval time.Duration, stopped func()) http.Handler {
+	var inuse atomic.Uint64
+	sample := func() {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		inuse.Store(stats.HeapInuse)
+	}
+	sample()
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		if stopped != nil {
+			defer stopped()
+		}
+		for {
+			select {
+			case <-ticker.C:
+				sample()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inuse.Load() > threshold {
+			WriteRetryAfter(w, http.StatusServiceUnavailable, interval, newOverloaded(r))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
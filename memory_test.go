@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestMemoryGuard(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	// Any running program uses more than one byte of heap.
+	MemoryGuardMiddleware(okHandler, 1).ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusServiceUnavailable)
+	test.AssertEquals(t, w.Header().Get("Retry-After"), "1")
+	test.AssertContains(t, w.Body.String(), "overloaded")
+
+	w = httptest.NewRecorder()
+	MemoryGuardMiddleware(okHandler, 1<<62).ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestMemoryGuardStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	h := memoryGuardMiddleware(ctx, okHandler, 1<<62, time.Millisecond, func() { close(stopped) })
+	cancel()
+	<-stopped
+
+	// The last sample is still used.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
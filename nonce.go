@@ -0,0 +1,49 @@
+package server
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NonceHeader is the request header NonceMiddleware reads.
+const NonceHeader = "X-Nonce"
+
+// NonceMiddleware protects h against replayed requests. Every request must
+// have a unique value in the X-Nonce header, like a random UUID; a request
+// without one gets a 400 error, and a request that reuses a nonce seen in
+// the last ttl gets a 409 error. Nonces are forgotten after ttl, so pair
+// the middleware with a check that rejects requests older than ttl, like a
+// signed timestamp.
+//
+// Unlike DedupeMiddleware, which catches accidental double submissions,
+// this rejects any reuse of a nonce, whatever the request. The nonces are
+// kept in memory, so they aren't shared between servers.
+func NonceMiddleware(h http.Handler, ttl time.Duration) http.Handler {
+	seen := newExpiringSet(ttl)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := strings.TrimSpace(r.Header.Get(NonceHeader))
+		if nonce == "" {
+			WriteError(w, &Error{
+				Title:      "Missing nonce",
+				Id:         "missing_nonce",
+				Detail:     "The " + NonceHeader + " header is required",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		if seen.add(sha256.Sum256([]byte(nonce)), time.Now()) {
+			WriteError(w, &Error{
+				Title:      "Replay detected",
+				Id:         "replay_detected",
+				Detail:     "This nonce has already been used",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusConflict,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
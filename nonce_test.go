@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestNonceMiddleware(t *testing.T) {
+	h := NonceMiddleware(okHandler, time.Minute)
+	serve := func(nonce string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/transfers", nil)
+		if nonce != "" {
+			req.Header.Set(NonceHeader, nonce)
+		}
+		h.ServeHTTP(w, req)
+		return w
+	}
+	test.AssertEquals(t, serve("abc").Code, http.StatusOK)
+	test.AssertEquals(t, serve("def").Code, http.StatusOK)
+	test.AssertErrorResponse(t, serve("abc"), http.StatusConflict, "replay_detected")
+	test.AssertErrorResponse(t, serve(""), http.StatusBadRequest, "missing_nonce")
+}
+
+func TestNonceExpires(t *testing.T) {
+	h := NonceMiddleware(okHandler, 10*time.Millisecond)
+	req, _ := http.NewRequest("POST", "/v1/transfers", nil)
+	req.Header.Set(NonceHeader, "abc")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	time.Sleep(20 * time.Millisecond)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"regexp/syntax"
+	"strings"
+)
+
+var errNotTemplatable = errors.New("pattern can't be converted to a path template")
+
+// pathTemplate converts a route pattern into an OpenAPI path template, for
+// example `^/v1/jobs/(?P<Id>[^\s\/]+)$` becomes "/v1/jobs/{Id}", and returns
+// the names of its path parameters. Only patterns made of literal text and
+// named capture groups can be converted.
+func pathTemplate(pattern string) (string, []string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", nil, err
+	}
+	var b strings.Builder
+	var params []string
+	var walk func(re *syntax.Regexp) error
+	walk = func(re *syntax.Regexp) error {
+		switch re.Op {
+		case syntax.OpConcat:
+			for _, sub := range re.Sub {
+				if err := walk(sub); err != nil {
+					return err
+				}
+			}
+		case syntax.OpLiteral:
+			b.WriteString(string(re.Rune))
+		case syntax.OpCapture:
+			if re.Name == "" {
+				return errNotTemplatable
+			}
+			b.WriteString("{" + re.Name + "}")
+			params = append(params, re.Name)
+		case syntax.OpBeginText, syntax.OpEndText, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpEmptyMatch:
+		default:
+			return errNotTemplatable
+		}
+		return nil
+	}
+	if err := walk(re); err != nil {
+		return "", nil, err
+	}
+	return b.String(), params, nil
+}
+
+// OpenAPIPaths returns a skeleton of the "paths" object of an OpenAPI
+// document for the registered routes, which can be encoded as JSON. Each
+// route's pattern is converted to a path template, with named capture groups
+// as path parameters, and each of its methods gets an operation listing those
+// parameters. Fill in the rest of each operation by hand.
+//
+// Patterns that use regex features other than literal text and named
+// capture groups, like alternation or unnamed groups, can't be converted,
+// and are skipped with a logged message.
+func (h *RegexpHandler) OpenAPIPaths() map[string]interface{} {
+	paths := make(map[string]interface{})
+	for _, route := range h.Routes() {
+		tmpl, params, err := pathTemplate(route.Pattern)
+		if err != nil {
+			log.Printf("server: skipping route %s in OpenAPI paths: %v", route.Pattern, err)
+			continue
+		}
+		item, ok := paths[tmpl].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[tmpl] = item
+		}
+		parameters := make([]interface{}, len(params))
+		for i, name := range params {
+			parameters[i] = map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			}
+		}
+		for _, method := range route.Methods {
+			item[strings.ToLower(method)] = map[string]interface{}{
+				"parameters": parameters,
+				"responses":  map[string]interface{}{},
+			}
+		}
+	}
+	return paths
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+var pathTemplateTests = []struct {
+	pattern string
+	want    string
+	params  []string
+	ok      bool
+}{
+	{`^/v1/jobs$`, "/v1/jobs", nil, true},
+	{`^/v1/jobs/(?P<Id>[^\s\/]+)$`, "/v1/jobs/{Id}", []string{"Id"}, true},
+	{`^/v1/users/(?P<User>[^\s\/]+)/jobs/(?P<Id>\d+)$`, "/v1/users/{User}/jobs/{Id}", []string{"User", "Id"}, true},
+	{`^/robots\.txt$`, "/robots.txt", nil, true},
+	{`^/v1/jobs/([^\s\/]+)$`, "", nil, false},
+	{`^/v1/(jobs|users)$`, "", nil, false},
+	{`^/v1/jobs/?$`, "", nil, false},
+}
+
+func TestPathTemplate(t *testing.T) {
+	for _, tt := range pathTemplateTests {
+		got, params, err := pathTemplate(tt.pattern)
+		if tt.ok {
+			test.AssertNotError(t, err, tt.pattern)
+			test.AssertEquals(t, got, tt.want)
+			test.AssertDeepEquals(t, params, tt.params)
+		} else {
+			test.AssertError(t, err, tt.pattern)
+		}
+	}
+}
+
+func TestOpenAPIPaths(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`), []string{"GET", "POST"}, okHandler)
+	h.Handler(BuildRoute(`^/v1/(a|b)$`), []string{"GET"}, okHandler)
+	paths := h.OpenAPIPaths()
+	test.AssertEquals(t, len(paths), 1)
+	item := paths["/v1/jobs/{Id}"].(map[string]interface{})
+	test.AssertEquals(t, len(item), 2)
+	op := item["get"].(map[string]interface{})
+	params := op["parameters"].([]interface{})
+	test.AssertEquals(t, params[0].(map[string]interface{})["name"], "Id")
+}
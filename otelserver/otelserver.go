@@ -0,0 +1,61 @@
+// Package otelserver creates OpenTelemetry server spans for requests routed
+// by a server.RegexpHandler. It lives in its own package so the core server
+// package doesn't depend on OpenTelemetry.
+package otelserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Shyp/go-servers"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OTelMiddleware starts a server span for each request, named after the
+// route pattern that matched it. Trace context is extracted from the request
+// headers with the global propagator, so the span joins the caller's trace.
+// The span records the method, path, route and response status, and is
+// marked as an error for 5xx responses.
+//
+// The span name comes from server.MatchedPattern, which is only set once the
+// RegexpHandler has routed the request, so OTelMiddleware must wrap the
+// route's handler, not the RegexpHandler itself:
+//
+//	h.Handler(route, []string{"GET"}, otelserver.OTelMiddleware(jobHandler, tracer))
+//
+// If it runs before routing, every span is named after the raw method
+// instead.
+func OTelMiddleware(h http.Handler, tracer trace.Tracer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		pattern := server.MatchedPattern(r)
+		name := r.Method
+		if pattern != "" {
+			name = fmt.Sprintf("%s %s", r.Method, pattern)
+		}
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		)
+		if pattern != "" {
+			span.SetAttributes(attribute.String("http.route", pattern))
+		}
+
+		rec := server.NewStatusRecorder(w)
+		h.ServeHTTP(rec, r.WithContext(ctx))
+		status := rec.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package otelserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers"
+	"github.com/Shyp/go-servers/test"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type recordingSpan struct {
+	noop.Span
+	name   string
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, description string) { s.status = code }
+func (s *recordingSpan) End(options ...trace.SpanEndOption)            { s.ended = true }
+
+type recordingTracer struct {
+	embedded.Tracer
+	span *recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.span = &recordingSpan{name: name, attrs: make(map[attribute.Key]attribute.Value)}
+	return trace.ContextWithSpan(ctx, t.span), t.span
+}
+
+func TestOTelMiddleware(t *testing.T) {
+	tracer := new(recordingTracer)
+	h := new(server.RegexpHandler)
+	route := server.BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`)
+	h.Handler(route, []string{"GET"}, OTelMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), tracer))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs/123", nil)
+	h.ServeHTTP(w, req)
+
+	span := tracer.span
+	test.Assert(t, span != nil, "expected a span to be started")
+	test.AssertEquals(t, span.name, "GET "+route.String())
+	test.AssertEquals(t, span.attrs["http.route"].AsString(), route.String())
+	test.AssertEquals(t, span.attrs["http.response.status_code"].AsInt64(), int64(503))
+	test.AssertEquals(t, span.status, codes.Error)
+	test.Assert(t, span.ended, "expected span to be ended")
+}
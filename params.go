@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// routeMatch records the route that matched a request. The capture groups
+// are only computed if a handler asks for them.
+type routeMatch struct {
+	pattern *regexp.Regexp
+	path    string
+	// Either rt or methods is set, depending on whether the match was
+	// recorded by a RegexpHandler or by WithRoute.
+	rt      *route
+	methods []string
+
+	once       sync.Once
+	submatches []string
+}
+
+func (m *routeMatch) matches() []string {
+	m.once.Do(func() {
+		m.submatches = m.pattern.FindStringSubmatch(m.path)
+	})
+	return m.submatches
+}
+
+func (m *routeMatch) allowedMethods() []string {
+	if m.rt != nil {
+		return m.rt.allowedMethods()
+	}
+	methods := make([]string, len(m.methods))
+	copy(methods, m.methods)
+	return methods
+}
+
+func withRouteMatch(r *http.Request, rt *route) *http.Request {
+	m := &routeMatch{pattern: rt.pattern, path: r.URL.Path, rt: rt}
+	return r.WithContext(context.WithValue(r.Context(), routeMatchKey, m))
+}
+
+// WithRoute returns a copy of ctx recording that the route with the given
+// pattern and methods matched path, as a RegexpHandler does before calling a
+// route's handler. It's mostly useful for testing handlers that call Params
+// or MatchedPattern without going through a RegexpHandler.
+func WithRoute(ctx context.Context, pattern *regexp.Regexp, path string, methods []string) context.Context {
+	m := &routeMatch{pattern: pattern, path: path, methods: methods}
+	return context.WithValue(ctx, routeMatchKey, m)
+}
+
+func routeMatchFromContext(ctx context.Context) *routeMatch {
+	m, _ := ctx.Value(routeMatchKey).(*routeMatch)
+	return m
+}
+
+func getRouteMatch(r *http.Request) *routeMatch {
+	return routeMatchFromContext(r.Context())
+}
+
+// MatchedPattern returns the pattern of the route that matched r, for
+// example `^/v1/jobs/(?P<Id>[^\s\/]+)$`, or the empty string if r was not
+// routed by a RegexpHandler. It's useful as a low-cardinality label for
+// logs, metrics and traces.
+func MatchedPattern(r *http.Request) string {
+	return MatchedPatternFromContext(r.Context())
+}
+
+// MatchedPatternFromContext is like MatchedPattern, for a request's context.
+func MatchedPatternFromContext(ctx context.Context) string {
+	m := routeMatchFromContext(ctx)
+	if m == nil {
+		return ""
+	}
+	return m.pattern.String()
+}
+
+// optionalSlashSuffixes are the ways a pattern can end with an optional
+// trailing slash. Escaped slashes come first, so `\/?` isn't trimmed to `\`.
+var optionalSlashSuffixes = []string{`\/?`, `\/*`, `(?:\/)?`, `(\/)?`, "/?", "/*", "(?:/)?", "(/)?"}
+
+// NormalizePatternLabel returns a cleaner version of a route pattern, for
+// use as a metric label: the ^ and $ anchors are removed, along with an
+// optional trailing slash at the end, so `^/v1/jobs/?$` and `^/v1/jobs$`
+// both become "/v1/jobs". Patterns are otherwise left unchanged.
+func NormalizePatternLabel(pattern string) string {
+	p := strings.TrimPrefix(pattern, "^")
+	if strings.HasSuffix(p, "$") && !strings.HasSuffix(p, `\$`) {
+		p = p[:len(p)-1]
+	}
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, suffix := range optionalSlashSuffixes {
+			if p != "/" && strings.HasSuffix(p, suffix) {
+				p = p[:len(p)-len(suffix)]
+				if p == "" {
+					p = "/"
+				}
+				trimmed = true
+			}
+		}
+	}
+	return p
+}
+
+// AllowedMethods returns the methods accepted by the route that matched r,
+// or nil if r was not routed by a RegexpHandler.
+func AllowedMethods(r *http.Request) []string {
+	return AllowedMethodsFromContext(r.Context())
+}
+
+// AllowedMethodsFromContext is like AllowedMethods, for a request's context.
+func AllowedMethodsFromContext(ctx context.Context) []string {
+	m := routeMatchFromContext(ctx)
+	if m == nil {
+		return nil
+	}
+	return m.allowedMethods()
+}
+
+// Params returns the named capture groups from the route that matched r, for
+// example the route `^/v1/jobs/(?P<Id>[^\s\/]+)$` and the path "/v1/jobs/123"
+// return {"Id": "123"}. Params returns an empty map if r was not routed by a
+// RegexpHandler.
+func Params(r *http.Request) map[string]string {
+	return ParamsFromContext(r.Context())
+}
+
+// ParamsFromContext is like Params, for a request's context.
+func ParamsFromContext(ctx context.Context) map[string]string {
+	params := make(map[string]string)
+	m := routeMatchFromContext(ctx)
+	if m == nil {
+		return params
+	}
+	submatches := m.matches()
+	for i, name := range m.pattern.SubexpNames() {
+		if i == 0 || name == "" || i >= len(submatches) {
+			continue
+		}
+		params[name] = submatches[i]
+	}
+	return params
+}
+
+// ParamsByIndex returns the capture groups from the route that matched r, in
+// the order they appear in the pattern. Index 0 is the first capture group,
+// not the whole match: for the route `^/v1/jobs/([^\s\/]+)$` and the path
+// "/v1/jobs/123", ParamsByIndex returns ["123"]. Named groups are included
+// too. ParamsByIndex returns nil if r was not routed by a RegexpHandler.
+func ParamsByIndex(r *http.Request) []string {
+	m := getRouteMatch(r)
+	if m == nil {
+		return nil
+	}
+	submatches := m.matches()
+	if len(submatches) == 0 {
+		return nil
+	}
+	params := make([]string, len(submatches)-1)
+	copy(params, submatches[1:])
+	return params
+}
+
+// BindParams copies the named capture groups from the route that matched r
+// into the fields of dst, which must be a pointer to a struct. A capture is
+// copied to the field with the same name, or the field with a matching
+// `param:"..."` tag. String, integer, unsigned integer and bool fields are
+// supported.
+//
+// If a capture can't be converted to its field's type, BindParams returns a
+// 400 Error that is ready to be written with WriteError. It returns nil on
+// success.
+func BindParams(r *http.Request, dst interface{}) *Error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return &Error{
+			Title:      "Internal server error",
+			Id:         "server_error",
+			Detail:     fmt.Sprintf("BindParams: dst must be a pointer to a struct, got %T", dst),
+			Instance:   r.URL.Path,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	v = v.Elem()
+	typ := v.Type()
+	params := Params(r)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := field.Tag.Get("param")
+		if name == "" {
+			name = field.Name
+		}
+		val, ok := params[name]
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), val); err != nil {
+			return &Error{
+				Title:      "Invalid path parameter",
+				Id:         "invalid_path_param",
+				Detail:     fmt.Sprintf("Could not parse path parameter %s (%q): %s", name, val, err.Error()),
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+	}
+	return nil
+}
+
+func setField(f reflect.Value, val string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestParams(t *testing.T) {
+	h := new(RegexpHandler)
+	var params map[string]string
+	h.HandleFunc(BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		params = Params(r)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs/job_123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertDeepEquals(t, params, map[string]string{"Id": "job_123"})
+}
+
+func TestBindParams(t *testing.T) {
+	type jobParams struct {
+		Id    int64
+		Owner string `param:"owner"`
+	}
+	h := new(RegexpHandler)
+	var p jobParams
+	h.HandleFunc(BuildRoute(`^/v1/users/(?P<owner>[^\s\/]+)/jobs/(?P<Id>\d+)$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		if err := BindParams(r, &p); err != nil {
+			WriteError(w, err)
+		}
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/users/kev/jobs/42", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, p.Id, int64(42))
+	test.AssertEquals(t, p.Owner, "kev")
+}
+
+func TestBindParamsTypeMismatch(t *testing.T) {
+	type jobParams struct {
+		Id int
+	}
+	h := new(RegexpHandler)
+	// The regex allows any characters, but the field is an int.
+	h.HandleFunc(BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		var p jobParams
+		if err := BindParams(r, &p); err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs/abc", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	test.AssertContains(t, w.Body.String(), "invalid_path_param")
+}
+
+func TestMatchedPattern(t *testing.T) {
+	h := new(RegexpHandler)
+	route := BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`)
+	var pattern string
+	h.HandleFunc(route, []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		pattern = MatchedPattern(r)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs/job_123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, pattern, route.String())
+	test.AssertEquals(t, MatchedPattern(req), "")
+}
+
+func TestParamsByIndex(t *testing.T) {
+	h := new(RegexpHandler)
+	var params []string
+	h.HandleFunc(BuildRoute(`^/v1/users/([^\s\/]+)/jobs/(?P<Id>[^\s\/]+)$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		params = ParamsByIndex(r)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/users/kev/jobs/123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertDeepEquals(t, params, []string{"kev", "123"})
+}
+
+func TestNormalizePatternLabel(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		want    string
+	}{
+		{`^/v1/jobs$`, "/v1/jobs"},
+		{`^/v1/jobs/?$`, "/v1/jobs"},
+		{`^/v1/jobs(?:/)?$`, "/v1/jobs"},
+		{`^/v1/jobs(/)?$`, "/v1/jobs"},
+		{`^\/v1\/jobs\/?$`, `\/v1\/jobs`},
+		{`^/v1/jobs/(?P<Id>[^\s\/]+)/?$`, `/v1/jobs/(?P<Id>[^\s\/]+)`},
+		{`^/?$`, "/"},
+		{`^/$`, "/"},
+		{`/v1/price\$`, `/v1/price\$`},
+		{`^/v1/jobs`, "/v1/jobs"},
+	} {
+		test.AssertEquals(t, NormalizePatternLabel(tt.pattern), tt.want)
+	}
+}
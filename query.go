@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RejectUnknownQuery returns a 400 Error if the request's query string
+// contains a key that is not in known, or nil if every key is recognized.
+// Handlers should call it before doing any work, and return early if the
+// error is non-nil:
+//
+//	if err := server.RejectUnknownQuery(r, "limit", "offset"); err != nil {
+//		server.WriteError(w, err)
+//		return
+//	}
+func RejectUnknownQuery(r *http.Request, known ...string) *Error {
+	unknown := make([]string, 0)
+	for key := range r.URL.Query() {
+		found := false
+		for _, k := range known {
+			if k == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return &Error{
+		Title:      "Unknown query parameter",
+		Id:         "unknown_parameter",
+		Detail:     fmt.Sprintf("Unknown query parameter: %s", strings.Join(unknown, ", ")),
+		Instance:   r.URL.Path,
+		StatusCode: http.StatusBadRequest,
+	}
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestRejectUnknownQuery(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v1/jobs?limit=10&offset=5", nil)
+	err := RejectUnknownQuery(req, "limit", "offset")
+	test.Assert(t, err == nil, "expected known params to be accepted")
+
+	req, _ = http.NewRequest("GET", "/v1/jobs?limt=10", nil)
+	err = RejectUnknownQuery(req, "limit", "offset")
+	test.AssertNotNil(t, err, "expected unknown param to be rejected")
+	test.AssertEquals(t, err.StatusCode, http.StatusBadRequest)
+	test.AssertEquals(t, err.Id, "unknown_parameter")
+	test.AssertContains(t, err.Detail, "limt")
+}
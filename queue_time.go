@@ -0,0 +1,54 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	queueTimes        = newLatencyRing(DefaultLatencySamples)
+	publishQueueTimes sync.Once
+)
+
+// parseRequestStart parses an X-Request-Start header, the time in
+// milliseconds since the Unix epoch, optionally prefixed with "t=".
+func parseRequestStart(hdr string) (time.Time, bool) {
+	hdr = strings.TrimPrefix(strings.TrimSpace(hdr), "t=")
+	ms, err := strconv.ParseInt(hdr, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// QueueTimeMiddleware measures how long requests wait between arriving at
+// the load balancer and reaching this server, using the X-Request-Start
+// header the load balancer adds, which holds the time it received the
+// request in milliseconds since the Unix epoch (optionally prefixed with
+// "t="). The wait is sent to the client in the X-Queue-Time header, in
+// milliseconds, and the p50, p90 and p99 waits over the last
+// DefaultLatencySamples requests are published as the "queue_time" expvar.
+//
+// Requests without the header, or with a malformed one or one in the future,
+// are passed to h without being measured. The measurement is only as good
+// as the clock sync between the load balancer and this server.
+func QueueTimeMiddleware(h http.Handler) http.Handler {
+	publishQueueTimes.Do(func() {
+		expvar.Publish("queue_time", expvar.Func(func() interface{} {
+			return queueTimes.percentiles()
+		}))
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if start, ok := parseRequestStart(r.Header.Get("X-Request-Start")); ok {
+			if wait := time.Since(start); wait >= 0 {
+				queueTimes.add(wait)
+				w.Header().Set("X-Queue-Time", strconv.FormatInt(wait.Milliseconds(), 10))
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+// queueTimeCount returns the number of samples in the "queue_time" expvar,
+// which is shared by every test in the package.
+func queueTimeCount(t *testing.T) int {
+	t.Helper()
+	var v struct {
+		Count int `json:"count"`
+	}
+	test.AssertNotError(t, json.Unmarshal([]byte(expvar.Get("queue_time").String()), &v), "")
+	return v.Count
+}
+
+func TestQueueTimeMiddleware(t *testing.T) {
+	h := QueueTimeMiddleware(okHandler)
+	before := queueTimeCount(t)
+	want := before + 1
+	if want > DefaultLatencySamples {
+		want = DefaultLatencySamples
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	req.Header.Set("X-Request-Start", strconv.FormatInt(time.Now().Add(-250*time.Millisecond).UnixMilli(), 10))
+	h.ServeHTTP(w, req)
+	wait, err := strconv.Atoi(w.Header().Get("X-Queue-Time"))
+	test.AssertNotError(t, err, "")
+	test.Assert(t, wait >= 250 && wait < 5000, "unexpected queue time "+strconv.Itoa(wait))
+	test.AssertEquals(t, queueTimeCount(t), want)
+
+	for _, hdr := range []string{"", "abc", strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/v1/jobs", nil)
+		req.Header.Set("X-Request-Start", hdr)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+		test.AssertEquals(t, w.Header().Get("X-Queue-Time"), "")
+	}
+	test.AssertEquals(t, queueTimeCount(t), want)
+}
+
+func TestParseRequestStart(t *testing.T) {
+	start, ok := parseRequestStart("t=1700000000123")
+	test.Assert(t, ok, "expected header to parse")
+	test.AssertEquals(t, start.UnixMilli(), int64(1700000000123))
+	_, ok = parseRequestStart("-5")
+	test.Assert(t, !ok, "expected negative time to be rejected")
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"expvar"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit configures a token bucket: requests are allowed at Rate per
+// second on average, with bursts of up to Burst requests.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// take removes a token from the bucket if one is available. If not, it
+// returns false and how long until the next token is added.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.limit.Rate <= 0 {
+		return false, time.Second
+	}
+	wait := (1 - b.tokens) / b.limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// RouteRateLimitMiddleware rate limits requests to individual routes in h.
+// limits maps a route's pattern (the String() of the regexp it was
+// registered with) to the rate allowed for that route; each route gets its
+// own token bucket, and routes that aren't in limits are not limited.
+// Requests over the limit get a 429 error with a Retry-After header.
+// Requests that get a 405 or an OPTIONS response aren't counted.
+//
+// The number of requests dropped for each route is published as an expvar
+// map with the given name, keyed by pattern. Like expvar.NewMap, it panics
+// if name is already in use.
+func RouteRateLimitMiddleware(h *RegexpHandler, limits map[string]RateLimit, name string) http.Handler {
+	buckets := make(map[string]*tokenBucket, len(limits))
+	for pattern, limit := range limits {
+		buckets[pattern] = newTokenBucket(limit)
+	}
+	drops := expvar.NewMap(name)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := h.matchRoute(r)
+		if route == nil {
+			h.serveMatched(w, r, route)
+			return
+		}
+		pattern := route.pattern.String()
+		bucket, ok := buckets[pattern]
+		if !ok || !h.handles(route, strings.ToUpper(r.Method)) {
+			h.serveMatched(w, r, route)
+			return
+		}
+		if ok, wait := bucket.take(time.Now()); !ok {
+			drops.Add(pattern, 1)
+			WriteRetryAfter(w, http.StatusTooManyRequests, wait, &Error{
+				Title:    "Too many requests",
+				Id:       "rate_limited",
+				Instance: r.URL.Path,
+			})
+			return
+		}
+		h.serveMatched(w, r, route)
+	})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestRouteRateLimit(t *testing.T) {
+	h := new(RegexpHandler)
+	hot := BuildRoute(`^/v1/hot$`)
+	h.Handler(hot, []string{"GET"}, okHandler)
+	h.Handler(BuildRoute(`^/v1/cold$`), []string{"GET"}, okHandler)
+	dropsName := uniqueExpvarName("test_route_rate_limit_drops")
+	limited := RouteRateLimitMiddleware(h, map[string]RateLimit{
+		hot.String(): {Rate: 0.001, Burst: 2},
+	}, dropsName)
+
+	codes := make([]int, 0)
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/hot", nil)
+		limited.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	test.AssertDeepEquals(t, codes, []int{200, 200, 429})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/cold", nil)
+		limited.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+	}
+
+	drops := expvar.Get(dropsName).(*expvar.Map)
+	test.AssertEquals(t, drops.Get(hot.String()).String(), "1")
+}
+
+func TestRouteRateLimitSkipsUnservedMethods(t *testing.T) {
+	h := new(RegexpHandler)
+	hot := BuildRoute(`^/v1/hot$`)
+	h.Handler(hot, []string{"GET"}, okHandler)
+	h.Handler(hot, []string{"POST"}, okHandler)
+	limited := RouteRateLimitMiddleware(h, map[string]RateLimit{
+		hot.String(): {Rate: 0.001, Burst: 2},
+	}, uniqueExpvarName("test_route_rate_limit_methods_drops"))
+
+	codes := make([]int, 0)
+	for _, method := range []string{"DELETE", "OPTIONS", "DELETE", "GET", "POST", "GET"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/v1/hot", nil)
+		limited.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	test.AssertDeepEquals(t, codes, []int{405, 200, 405, 200, 200, 429})
+}
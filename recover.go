@@ -0,0 +1,61 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"runtime"
+)
+
+// RecoverMiddleware recovers from panics in h, logs the panic value and stack
+// trace, and returns a 500 error to the client.
+//
+// If onPanic is not nil, it is called with the request, the recovered value
+// and the stack trace of the panicking goroutine before the error response is
+// written. Use it to forward panics to an error tracking service.
+//
+// RecoverMiddleware can wrap the whole server, or only the handlers of the
+// routes that need it, so panics in other routes still crash loudly while
+// you debug them:
+//
+//	h.Handler(route, []string{"GET"}, server.RecoverMiddleware(riskyHandler, nil))
+//
+// If the panic value is an *Error or an Error, it's written to the client
+// with WriteError instead, and isn't logged or passed to onPanic. This lets a
+// handler deep in a call stack abort the request with a specific error:
+//
+//	panic(server.NewError(404, "not_found", "Job not found"))
+//
+// Use this sparingly. A panic skips the deferred cleanup of every function
+// it unwinds through that doesn't expect it, it's slower than returning an
+// error, and it hides the control flow from anyone reading the handler.
+func RecoverMiddleware(h http.Handler, onPanic func(r *http.Request, recovered interface{}, stack []byte)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rv := recover(); rv != nil {
+				switch e := rv.(type) {
+				case *Error:
+					// A nil *Error is a bug, so it's treated like
+					// any other panic.
+					if e != nil {
+						WriteError(w, e)
+						return
+					}
+				case Error:
+					WriteError(w, &e)
+					return
+				}
+				if rv == http.ErrAbortHandler {
+					panic(rv)
+				}
+				stack := make([]byte, 64<<10)
+				stack = stack[:runtime.Stack(stack, false)]
+				log.Printf("server: panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rv, stack)
+				if onPanic != nil {
+					onPanic(r, rv, stack)
+				}
+				WriteError(w, new500(r))
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestRecoverMiddlewareCallsOnPanic(t *testing.T) {
+	var got interface{}
+	var stack []byte
+	h := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), func(r *http.Request, recovered interface{}, s []byte) {
+		got = recovered
+		stack = s
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusInternalServerError)
+	test.AssertContains(t, w.Body.String(), "server_error")
+	test.AssertEquals(t, got, "boom")
+	test.Assert(t, strings.Contains(string(stack), "goroutine"), "expected a stack trace")
+}
+
+func TestRecoverMiddlewareTypedError(t *testing.T) {
+	called := false
+	onPanic := func(r *http.Request, recovered interface{}, s []byte) {
+		called = true
+	}
+	for _, rv := range []interface{}{NewError(404, "not_found", "Job not found"), *NewError(404, "not_found", "Job not found")} {
+		rv := rv
+		h := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(rv)
+		}), onPanic)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/jobs/123", nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusNotFound)
+		test.AssertContains(t, w.Body.String(), `"title":"Job not found"`)
+	}
+	test.Assert(t, !called, "onPanic should not be called for typed errors")
+}
+
+func TestRecoverMiddlewareNilError(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	var got interface{}
+	h := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic((*Error)(nil))
+	}), func(r *http.Request, recovered interface{}, s []byte) {
+		got = recovered
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusInternalServerError)
+	test.AssertContains(t, w.Body.String(), "server_error")
+	test.Assert(t, got != nil, "expected onPanic to be called")
+}
+
+func TestRecoverMiddlewarePerRoute(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	panicky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/risky$`), []string{"GET"}, RecoverMiddleware(panicky, nil))
+	h.Handler(BuildRoute(`^/v1/other$`), []string{"GET"}, panicky)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/risky", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusInternalServerError)
+	var e Error
+	test.AssertNotError(t, json.Unmarshal(w.Body.Bytes(), &e), "")
+	test.AssertEquals(t, e.Id, "server_error")
+	test.AssertEquals(t, e.Instance, "/v1/risky")
+
+	var recovered interface{}
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		req, _ := http.NewRequest("GET", "/v1/other", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	test.AssertEquals(t, recovered, "boom")
+}
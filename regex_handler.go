@@ -5,6 +5,7 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"expvar"
 	"fmt"
 	"io"
@@ -13,16 +14,144 @@ import (
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/http/pprof"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type route struct {
 	pattern *regexp.Regexp
 	methods []string
 	handler http.Handler
+
+	// literal is set for routes registered with HandleExactPath. The path
+	// is compared directly instead of being matched against pattern.
+	literal string
+
+	// queryKey and queryValue are set for routes registered with
+	// HandleQuery. The route only matches if the query parameter is equal
+	// to queryValue.
+	queryKey   string
+	queryValue string
+
+	// methodHandlers is set for routes registered with HandleMethods, and
+	// maps an upper case method to the handler for that method.
+	methodHandlers map[string]http.Handler
+
+	// except is set for routes registered with HandleAllExcept, and holds
+	// the upper case methods the route doesn't accept.
+	except map[string]bool
+
+	// priority is set for routes registered with HandlePriority. Routes
+	// with a higher priority are tried first.
+	priority int
+
+	// maxBodyBytes is set for routes registered with
+	// HandleWithMaxBodyBytes, or with a RouteDef's MaxBodyBytes.
+	maxBodyBytes int64
+
+	// mediaType is set for routes registered with HandleAccept, and is the
+	// lower case media type the route responds with.
+	mediaType string
+
+	// enabled is set for routes registered with HandleIf. The route is
+	// skipped while it returns false.
+	enabled func() bool
+
+	// mountPrefix and mounted are set for routes registered with Mount.
+	// handler strips the prefix and calls mounted for every method,
+	// including OPTIONS.
+	mountPrefix string
+	mounted     http.Handler
+
+	// negotiated is set if a route with the same key has a media type, so
+	// requests for it go through content negotiation. It's set when routes
+	// are added, and not cleared when they're removed.
+	negotiated atomic.Bool
+}
+
+// standardMethods are the methods listed in the Allow header for routes that
+// accept any method.
+var standardMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// wildcard reports whether the route accepts any method not in except.
+func (rt *route) wildcard() bool {
+	if rt.except != nil {
+		return true
+	}
+	for _, m := range rt.methods {
+		if m == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerFor returns the handler for the given (upper case) method, or nil if
+// the route doesn't accept the method.
+func (rt *route) handlerFor(method string) http.Handler {
+	if rt.mounted != nil {
+		return rt.handler
+	}
+	if rt.methodHandlers != nil {
+		return rt.methodHandlers[method]
+	}
+	if rt.wildcard() {
+		// OPTIONS is answered by the RegexpHandler, with the Allow header.
+		if method == "OPTIONS" || rt.except[method] {
+			return nil
+		}
+		return rt.handler
+	}
+	for _, m := range rt.methods {
+		if strings.ToUpper(m) == method {
+			return rt.handler
+		}
+	}
+	return nil
+}
+
+// allowedMethods returns the methods to list in the Allow header, not
+// including OPTIONS.
+func (rt *route) allowedMethods() []string {
+	if !rt.wildcard() {
+		methods := make([]string, len(rt.methods))
+		copy(methods, rt.methods)
+		return methods
+	}
+	methods := make([]string, 0, len(standardMethods))
+	for _, m := range standardMethods {
+		if !rt.except[m] {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// active reports whether the route is enabled.
+func (rt *route) active() bool {
+	return rt.enabled == nil || rt.enabled()
+}
+
+func (rt *route) matches(r *http.Request) bool {
+	if !rt.active() {
+		return false
+	}
+	if rt.literal != "" {
+		if r.URL.Path != rt.literal {
+			return false
+		}
+	} else if !rt.pattern.MatchString(r.URL.Path) {
+		return false
+	}
+	if rt.queryKey != "" && r.URL.Query().Get(rt.queryKey) != rt.queryValue {
+		return false
+	}
+	return true
 }
 
 func BuildRoute(regex string) *regexp.Regexp {
@@ -33,20 +162,250 @@ func BuildRoute(regex string) *regexp.Regexp {
 	return route
 }
 
+// BuildExactRoute is like BuildRoute, but anchors the pattern so it must
+// match the entire path. The pattern is wrapped in ^(?:...)$, so "/v1/jobs"
+// matches "/v1/jobs" but not "/v1/jobs/123" or "/api/v1/jobs".
+func BuildExactRoute(regex string) *regexp.Regexp {
+	return BuildRoute("^(?:" + regex + ")$")
+}
+
 // RegexpHandler is a HTTP handler that can handle regex routes. If a route
 // doesn't match, a 404 error message is returned.
+//
+// Routes can be added and removed while the handler is serving requests.
 type RegexpHandler struct {
-	routes []*route
+	// mu protects routes. The slice is never modified in place once it's
+	// been shared, so ServeHTTP can iterate over a snapshot without holding
+	// the lock.
+	mu        sync.RWMutex
+	routes    []*route
+	fallbacks map[string]http.Handler
+
+	// HTMLNotFound, if set, serves requests that don't match any route when
+	// the client's Accept header prefers text/html to application/json, so
+	// browsers get a page instead of a JSON error. Other clients still get
+	// the JSON 404.
+	HTMLNotFound http.Handler
+
+	// DebugRoutes adds an X-Matched-Route header to every response, with the
+	// pattern of the route that matched the request, or "none" if no route
+	// matched. Use it to debug overlapping patterns; it exposes your route
+	// table to clients, so don't enable it in production.
+	DebugRoutes bool
+
+	// BeforeMatch, if set, is called after a route has matched the request
+	// and before the route's handler, with the route's Params already
+	// available from r. If it returns false, the handler is not called;
+	// BeforeMatch must write the response itself. Use it for checks that
+	// need the matched route, like authorizing access to the resource named
+	// in the path. It isn't called for requests that don't match a route, or
+	// that get a 405 or an OPTIONS response.
+	BeforeMatch func(w http.ResponseWriter, r *http.Request) bool
+
+	// DescriptiveOptions makes OPTIONS requests for a route return a JSON
+	// body describing it, with the methods it accepts and the names of the
+	// named capture groups in its pattern:
+	//
+	//	{"methods": ["GET", "POST", "OPTIONS"], "path_params": ["Id"]}
+	//
+	// By default, OPTIONS requests get an empty 200. The Allow header is
+	// set either way.
+	DescriptiveOptions bool
+
+	// MaxBodyBytes, if positive, limits the size of request bodies for
+	// routes that don't set their own limit with HandleWithMaxBodyBytes or
+	// RouteDef.MaxBodyBytes. See HandleWithMaxBodyBytes.
+	MaxBodyBytes int64
+}
+
+// ReadMethods returns the methods read-only routes are usually registered
+// with, GET and HEAD:
+//
+//	h.HandleFunc(route, server.ReadMethods(), getJob)
+//
+// It returns a new slice each time, so callers can modify it.
+func ReadMethods() []string {
+	return []string{"GET", "HEAD"}
+}
+
+// WriteMethods returns the methods routes that create or update a resource
+// are usually registered with, POST, PUT and PATCH:
+//
+//	h.HandleFunc(route, server.WriteMethods(), updateJob)
+//
+// It doesn't include DELETE, which usually has a handler of its own. It
+// returns a new slice each time, so callers can modify it.
+func WriteMethods() []string {
+	return []string{"POST", "PUT", "PATCH"}
+}
+
+func (h *RegexpHandler) addRoute(rt *route) {
+	rt.methods = append([]string(nil), rt.methods...)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Mark routes that share a key with a route with a media type, so
+	// requests for routes without one skip content negotiation.
+	key := rt.key()
+	for _, existing := range h.routes {
+		if existing.key() != key {
+			continue
+		}
+		if rt.mediaType != "" {
+			existing.negotiated.Store(true)
+		}
+		if existing.mediaType != "" {
+			rt.negotiated.Store(true)
+		}
+	}
+	if rt.mediaType != "" {
+		rt.negotiated.Store(true)
+	}
+	// Keep routes sorted by priority, highest first, and in registration
+	// order among routes with the same priority.
+	i := len(h.routes)
+	for i > 0 && h.routes[i-1].priority < rt.priority {
+		i--
+	}
+	if i == len(h.routes) {
+		h.routes = append(h.routes, rt)
+		return
+	}
+	routes := make([]*route, 0, len(h.routes)+1)
+	routes = append(routes, h.routes[:i]...)
+	routes = append(routes, rt)
+	h.routes = append(routes, h.routes[i:]...)
+}
+
+func (h *RegexpHandler) removeRoute(rt *route) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, existing := range h.routes {
+		if existing == rt {
+			routes := make([]*route, 0, len(h.routes)-1)
+			routes = append(routes, h.routes[:i]...)
+			h.routes = append(routes, h.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetFallback sets the handler for requests with the given method that
+// don't match any route, for example a GET handler that serves a single page
+// app, while other methods still get a JSON 404. The empty method sets the
+// fallback for methods that don't have their own. Passing a nil handler
+// removes the fallback.
+func (h *RegexpHandler) SetFallback(method string, handler http.Handler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	method = strings.ToUpper(method)
+	if handler == nil {
+		delete(h.fallbacks, method)
+		return
+	}
+	if h.fallbacks == nil {
+		h.fallbacks = make(map[string]http.Handler)
+	}
+	h.fallbacks[method] = handler
+}
+
+func (h *RegexpHandler) getFallback(method string) http.Handler {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if fallback, ok := h.fallbacks[strings.ToUpper(method)]; ok {
+		return fallback
+	}
+	return h.fallbacks[""]
+}
+
+func (h *RegexpHandler) getRoutes() []*route {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.routes
 }
 
 func (h *RegexpHandler) Handler(pattern *regexp.Regexp, methods []string, handler http.Handler) {
-	h.routes = append(h.routes, &route{
+	h.addRoute(&route{
 		pattern: pattern,
 		methods: methods,
 		handler: handler,
 	})
 }
 
+// RouteDef describes a route, for registering a table of routes at once with
+// RegisterAll.
+type RouteDef struct {
+	Pattern string
+	Methods []string
+	Handler http.Handler
+	// MaxBodyBytes, if positive, limits the size of request bodies for the
+	// route, like HandleWithMaxBodyBytes.
+	MaxBodyBytes int64
+}
+
+// RegisterAll compiles the pattern of every route in routes and registers
+// them in order. Unlike BuildRoute, an invalid pattern doesn't exit the
+// program; instead RegisterAll returns an error naming the first invalid
+// pattern (and wrapping its *syntax.Error), and no routes are registered.
+func (h *RegexpHandler) RegisterAll(routes []RouteDef) error {
+	compiled := make([]*route, 0, len(routes))
+	var firstErr error
+	failures := 0
+	for _, def := range routes {
+		pattern, err := regexp.Compile(def.Pattern)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("server: invalid route pattern %q: %w", def.Pattern, err)
+			}
+			failures++
+			continue
+		}
+		compiled = append(compiled, &route{
+			pattern:      pattern,
+			methods:      def.Methods,
+			handler:      def.Handler,
+			maxBodyBytes: def.MaxBodyBytes,
+		})
+	}
+	if failures > 1 {
+		return fmt.Errorf("%w (and %d more invalid patterns)", firstErr, failures-1)
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	for _, rt := range compiled {
+		h.addRoute(rt)
+	}
+	return nil
+}
+
+// RouteHandle refers to a route registered with AddRemovableRoute.
+type RouteHandle struct {
+	h  *RegexpHandler
+	rt *route
+}
+
+// Remove unregisters the route. Requests that have already been routed to
+// the route's handler are unaffected. Remove is safe to call more than once,
+// and from any goroutine.
+func (rh RouteHandle) Remove() {
+	if rh.h != nil {
+		rh.h.removeRoute(rh.rt)
+	}
+}
+
+// AddRemovableRoute registers handler for pattern like Handler, and returns a
+// RouteHandle that can be used to remove the route later, for example when a
+// feature flag is turned off.
+func (h *RegexpHandler) AddRemovableRoute(pattern *regexp.Regexp, methods []string, handler http.Handler) RouteHandle {
+	rt := &route{
+		pattern: pattern,
+		methods: methods,
+		handler: handler,
+	}
+	h.addRoute(rt)
+	return RouteHandle{h: h, rt: rt}
+}
+
 // JSONMiddleware is a middleware that adds the application/json content type to
 // a response.
 func JSONMiddleware(h http.Handler) http.Handler {
@@ -58,16 +417,123 @@ func JSONMiddleware(h http.Handler) http.Handler {
 
 var mu sync.Mutex
 
+// DebugRedactedHeaders lists the request and response headers whose values
+// DebugRequestBodyMiddleware replaces with "[REDACTED]" in its output.
+var DebugRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Internal-Token"}
+
+// DebugRedactedQueryParams lists the query parameters whose values
+// DebugRequestBodyMiddleware replaces with "[REDACTED]" in the URLs it
+// prints. Parameter names are case sensitive.
+var DebugRedactedQueryParams = []string{"token", "access_token", "signature"}
+
+// redactURL returns a copy of u with the values of DebugRedactedQueryParams
+// replaced. u is returned unchanged if none of them are present.
+func redactURL(u *url.URL) *url.URL {
+	if u.RawQuery == "" {
+		return u
+	}
+	query := u.Query()
+	redact := make(map[string]bool)
+	for _, name := range DebugRedactedQueryParams {
+		if _, ok := query[name]; ok {
+			redact[name] = true
+		}
+	}
+	if len(redact) == 0 {
+		return u
+	}
+	// Like query.Encode, but without escaping the brackets in
+	// "[REDACTED]", so the placeholder is readable in the output.
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range query[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(k))
+			b.WriteByte('=')
+			if redact[k] {
+				b.WriteString("[REDACTED]")
+			} else {
+				b.WriteString(url.QueryEscape(v))
+			}
+		}
+	}
+	u2 := *u
+	u2.RawQuery = b.String()
+	return &u2
+}
+
+// redactHeaders returns a copy of h with the values of DebugRedactedHeaders
+// replaced.
+func redactHeaders(h http.Header) http.Header {
+	h2 := cloneHeader(h)
+	for _, name := range DebugRedactedHeaders {
+		if vals, ok := h2[http.CanonicalHeaderKey(name)]; ok {
+			for i := range vals {
+				vals[i] = "[REDACTED]"
+			}
+		}
+	}
+	return h2
+}
+
 // DebugRequestBodyHandler prints all incoming and outgoing HTTP traffic if the
-// DEBUG_HTTP_TRAFFIC environment variable is set to true.
+// DEBUG_HTTP_TRAFFIC environment variable is set to true. The values of
+// headers in DebugRedactedHeaders and query parameters in
+// DebugRedactedQueryParams are not printed; the request passed to h is not
+// modified.
 func DebugRequestBodyMiddleware(h http.Handler) http.Handler {
+	return debugTraffic(h, false)
+}
+
+// DebugRequestBodyMiddlewareWithLabels is like DebugRequestBodyMiddleware,
+// but starts each request's output with a line giving its sequence number
+// and, if it has one, its RequestID, for example:
+//
+//	--- request 42 (id 5f2b...) ---
+//
+// Requests are served concurrently, and each request's output is written in
+// one piece once its response is complete, so output from concurrent
+// requests isn't interleaved but may appear out of sequence.
+func DebugRequestBodyMiddlewareWithLabels(h http.Handler) http.Handler {
+	return debugTraffic(h, true)
+}
+
+var debugSequence atomic.Uint64
+
+func debugTraffic(h http.Handler, labeled bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if os.Getenv("DEBUG_HTTP_TRAFFIC") == "true" {
-			mu.Lock()
-			defer mu.Unlock()
+			if !labeled {
+				mu.Lock()
+				defer mu.Unlock()
+			}
 			// You want to write the entire thing in one Write.
 			b := new(bytes.Buffer)
-			bits, err := httputil.DumpRequest(r, true)
+			if labeled {
+				seq := debugSequence.Add(1)
+				if id := RequestID(r); id != "" {
+					fmt.Fprintf(b, "--- request %d (id %s) ---\r\n", seq, id)
+				} else {
+					fmt.Fprintf(b, "--- request %d ---\r\n", seq)
+				}
+			}
+			// Dump a copy with the sensitive headers redacted. DumpRequest
+			// replaces the body it reads, so hand the new one back to r.
+			sanitized := *r
+			sanitized.Header = redactHeaders(r.Header)
+			if u := redactURL(r.URL); u != r.URL {
+				sanitized.URL = u
+				sanitized.RequestURI = ""
+			}
+			bits, err := httputil.DumpRequest(&sanitized, true)
+			r.Body = sanitized.Body
 			if err != nil {
 				_, _ = b.WriteString(err.Error())
 			} else {
@@ -77,14 +543,18 @@ func DebugRequestBodyMiddleware(h http.Handler) http.Handler {
 			h.ServeHTTP(res, r)
 
 			_, _ = b.WriteString(fmt.Sprintf("HTTP/1.1 %d\r\n", res.Code))
-			_ = res.HeaderMap.Write(b)
-			w.WriteHeader(res.Code)
+			_ = redactHeaders(res.HeaderMap).Write(b)
 			for k, v := range res.HeaderMap {
 				w.Header()[k] = v
 			}
+			w.WriteHeader(res.Code)
 			_, _ = b.WriteString("\r\n")
 			writer := io.MultiWriter(w, b)
 			_, _ = res.Body.WriteTo(writer)
+			if labeled {
+				mu.Lock()
+				defer mu.Unlock()
+			}
 			_, _ = b.WriteTo(os.Stderr)
 		} else {
 			h.ServeHTTP(w, r)
@@ -95,11 +565,19 @@ func DebugRequestBodyMiddleware(h http.Handler) http.Handler {
 // ExpvarMiddleware exports an expvar route at the given endpoint. If the
 // endpoint is the empty string, the endpoint will be exposed at /debug/vars.
 func ExpvarMiddleware(h http.Handler, endpoint string) http.Handler {
+	return ToggledExpvarMiddleware(h, endpoint, nil)
+}
+
+// ToggledExpvarMiddleware is like ExpvarMiddleware, but the endpoint is only
+// exposed while enabled is true. When enabled is false, requests for the
+// endpoint fall through to h (typically resulting in a 404). enabled can be
+// flipped at any time from any goroutine; a nil enabled is always on.
+func ToggledExpvarMiddleware(h http.Handler, endpoint string, enabled *atomic.Bool) http.Handler {
 	if endpoint == "" {
 		endpoint = "/debug/vars"
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != endpoint {
+		if r.URL.Path != endpoint || (enabled != nil && !enabled.Load()) {
 			h.ServeHTTP(w, r)
 		} else {
 			// Implementation here is taken from the expvar package.
@@ -122,11 +600,19 @@ func ExpvarMiddleware(h http.Handler, endpoint string) http.Handler {
 // with the given prefix. If the prefix is the empty string, default to
 // /debug/pprof.
 func PprofMiddleware(h http.Handler, prefix string) http.Handler {
+	return ToggledPprofMiddleware(h, prefix, nil)
+}
+
+// ToggledPprofMiddleware is like PprofMiddleware, but the endpoints are only
+// exposed while enabled is true. When enabled is false, requests fall
+// through to h. enabled can be flipped at any time from any goroutine; a nil
+// enabled is always on.
+func ToggledPprofMiddleware(h http.Handler, prefix string, enabled *atomic.Bool) http.Handler {
 	if prefix == "" {
 		prefix = "/debug/pprof"
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.HasPrefix(r.URL.Path, prefix) {
+		if !strings.HasPrefix(r.URL.Path, prefix) || (enabled != nil && !enabled.Load()) {
 			h.ServeHTTP(w, r)
 			return
 		}
@@ -145,36 +631,508 @@ func PprofMiddleware(h http.Handler, prefix string) http.Handler {
 }
 
 func (h *RegexpHandler) HandleFunc(pattern *regexp.Regexp, methods []string, handler func(http.ResponseWriter, *http.Request)) {
-	h.routes = append(h.routes, &route{
+	h.addRoute(&route{
 		pattern: pattern,
 		methods: methods,
 		handler: http.HandlerFunc(handler),
 	})
 }
 
-func (h *RegexpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	for _, route := range h.routes {
-		if route.pattern.MatchString(r.URL.Path) {
-			upperMethod := strings.ToUpper(r.Method)
-			for _, method := range route.methods {
-				if strings.ToUpper(method) == upperMethod {
-					route.handler.ServeHTTP(w, r)
-					return
-				}
+// HandlePriority registers handler for pattern like Handler, but with the
+// given priority. Routes are tried in order of priority, highest first, so
+// a route can take precedence over an overlapping route that was registered
+// earlier. Routes registered with the other Handle methods have priority 0,
+// and routes with the same priority are tried in the order they were
+// registered.
+func (h *RegexpHandler) HandlePriority(priority int, pattern *regexp.Regexp, methods []string, handler http.Handler) {
+	h.addRoute(&route{
+		pattern:  pattern,
+		methods:  methods,
+		handler:  handler,
+		priority: priority,
+	})
+}
+
+// HandleWithMaxBodyBytes registers handler for pattern like Handler, and
+// limits request bodies for the route to maxBytes. A request whose
+// Content-Length is larger gets a 413 error without handler being called;
+// for a request without a Content-Length, reading more than maxBytes from
+// the body fails with an *http.MaxBytesError.
+//
+// The limit replaces the RegexpHandler's MaxBodyBytes for this route, so an
+// upload route can allow larger bodies than the default. A limit applied
+// outside the RegexpHandler, for example with http.MaxBytesReader in a
+// middleware, still applies as well, so the smaller of the two wins; set the
+// global limit with MaxBodyBytes instead if routes need to raise it.
+func (h *RegexpHandler) HandleWithMaxBodyBytes(pattern *regexp.Regexp, methods []string, maxBytes int64, handler http.Handler) {
+	h.addRoute(&route{
+		pattern:      pattern,
+		methods:      methods,
+		handler:      handler,
+		maxBodyBytes: maxBytes,
+	})
+}
+
+// HandleAccept registers handler for pattern like Handler, as the handler
+// for requests that accept mediaType, for example "text/csv". Register a
+// route with HandleAccept for each media type a path can return, and
+// requests are routed to the one whose media type the Accept header gives
+// the highest quality, as computed by AcceptsMediaType; ties go to the
+// route registered first. A route for the same pattern registered without a
+// media type handles requests that don't accept any of them. Otherwise
+// those requests get a 406 error.
+//
+// Responses from negotiated routes vary on the Accept header, and get the
+// route's media type as their Content-Type unless the handler sets one.
+func (h *RegexpHandler) HandleAccept(pattern *regexp.Regexp, methods []string, mediaType string, handler http.Handler) {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	h.addRoute(&route{
+		pattern: pattern,
+		methods: methods,
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", mediaType)
+			handler.ServeHTTP(w, r)
+		}),
+		mediaType: mediaType,
+	})
+}
+
+// negotiate picks the route among siblings to serve r's method, taking the
+// media types of routes registered with HandleAccept into account. It
+// returns a nil route if no route accepts the method, and a nil route with
+// acceptable false if routes accept the method but none of them the
+// request's Accept header.
+func negotiate(r *http.Request, siblings []*route, method string) (rt *route, handler http.Handler, acceptable bool) {
+	accept := r.Header.Get("Accept")
+	var plain, best *route
+	var plainHandler, bestHandler http.Handler
+	bestQ := 0.0
+	candidates := 0
+	for _, sibling := range siblings {
+		sh := sibling.handlerFor(method)
+		if sh == nil {
+			continue
+		}
+		candidates++
+		if sibling.mediaType == "" {
+			if plain == nil {
+				plain, plainHandler = sibling, sh
 			}
-			if upperMethod == "OPTIONS" {
-				methods := strings.Join(append(route.methods, "OPTIONS"), ", ")
-				w.Header().Set("Allow", methods)
-				return
-			} else {
-				w.Header().Set("Content-Type", "application/json; charset=utf-8")
-				w.WriteHeader(http.StatusMethodNotAllowed)
-				json.NewEncoder(w).Encode(new405(r))
+			continue
+		}
+		if ok, q := AcceptsMediaType(accept, sibling.mediaType); ok && q > bestQ {
+			best, bestHandler, bestQ = sibling, sh, q
+		}
+	}
+	switch {
+	case best != nil:
+		return best, bestHandler, true
+	case plain != nil:
+		return plain, plainHandler, true
+	default:
+		return nil, nil, candidates == 0
+	}
+}
+
+// HandleIf registers handler for pattern like Handler, but the route is only
+// used while enabled returns true, for example to put an endpoint behind a
+// feature flag. enabled is called for every request the route could serve,
+// so the flag can be changed at any time; it must be safe to call from many
+// goroutines, and fast. While the route is disabled, requests are routed as
+// if it weren't registered, typically getting a 404.
+func (h *RegexpHandler) HandleIf(enabled func() bool, pattern *regexp.Regexp, methods []string, handler http.Handler) {
+	h.addRoute(&route{
+		pattern: pattern,
+		methods: methods,
+		handler: handler,
+		enabled: enabled,
+	})
+}
+
+// stripMountPrefix removes prefix from path, keeping the leading slash.
+func stripMountPrefix(path, prefix string) string {
+	path = strings.TrimPrefix(path, prefix)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// Mount routes every request whose path is prefix, or starts with prefix
+// followed by a slash, to sub with the prefix removed from the path. For
+// example, after
+//
+//	parent.Mount("/v2", v2)
+//
+// a request for /v2/jobs/123 is served by v2 as a request for /jobs/123, so
+// v2's patterns are written without the prefix, like `^/jobs/(?P<Id>\w+)$`.
+// A request for /v2 itself becomes a request for /. sub gets every method,
+// and its own 404, 405 and OPTIONS responses are sent to the client. If sub
+// is a RegexpHandler, MatchedPattern and Params in its handlers refer to
+// sub's route, and the Matches method of the parent checks sub's routes too.
+func (h *RegexpHandler) Mount(prefix string, sub http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	h.addRoute(&route{
+		pattern: regexp.MustCompile("^" + regexp.QuoteMeta(prefix) + "(?:/|$)"),
+		methods: []string{"*"},
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r2 := new(http.Request)
+			*r2 = *r
+			u := *r.URL
+			u.Path = stripMountPrefix(r.URL.Path, prefix)
+			if r.URL.RawPath != "" {
+				u.RawPath = stripMountPrefix(r.URL.RawPath, prefix)
 			}
+			r2.URL = &u
+			sub.ServeHTTP(w, r2)
+		}),
+		mountPrefix: prefix,
+		mounted:     sub,
+	})
+}
+
+// HandleExact compiles pathRegex with BuildExactRoute and registers handler
+// for it.
+func (h *RegexpHandler) HandleExact(pathRegex string, methods []string, handler func(http.ResponseWriter, *http.Request)) {
+	h.HandleFunc(BuildExactRoute(pathRegex), methods, handler)
+}
+
+// HandleContentType registers handler for pattern, and sets the response's
+// Content-Type header to contentType before handler is called. Use it for
+// routes that don't return JSON, for example a CSV export. The handler can
+// still override the header.
+func (h *RegexpHandler) HandleContentType(pattern *regexp.Regexp, methods []string, contentType string, handler func(http.ResponseWriter, *http.Request)) {
+	h.Handler(pattern, methods, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		handler(w, r)
+	}))
+}
+
+// HandleQuery registers handler for requests whose path matches pathRegex
+// and whose queryKey query parameter is equal to queryValue, for example
+// /search?type=jobs. If the query parameter doesn't match, the route is
+// skipped and later routes are tried, as if the path hadn't matched.
+//
+// Routes with the same priority are tried in the order they're registered,
+// so register constrained routes before an unconstrained route for the same
+// path; an unconstrained route registered first will handle every request
+// for that path.
+func (h *RegexpHandler) HandleQuery(pathRegex *regexp.Regexp, methods []string, queryKey, queryValue string, handler http.Handler) {
+	h.addRoute(&route{
+		pattern:    pathRegex,
+		methods:    methods,
+		handler:    handler,
+		queryKey:   queryKey,
+		queryValue: queryValue,
+	})
+}
+
+// HandleAllExcept registers handler for every method on pattern except the
+// ones in excluded, which get a 405. This is useful for routes that proxy
+// requests to another server. Passing "*" as the only method to Handler or
+// HandleFunc is equivalent to HandleAllExcept with no exclusions.
+//
+// OPTIONS requests for the route are answered with an Allow header listing
+// GET, HEAD, POST, PUT, PATCH and DELETE, minus the excluded methods.
+func (h *RegexpHandler) HandleAllExcept(pattern *regexp.Regexp, excluded []string, handler http.Handler) {
+	except := make(map[string]bool, len(excluded))
+	for _, method := range excluded {
+		except[strings.ToUpper(method)] = true
+	}
+	h.addRoute(&route{
+		pattern: pattern,
+		methods: []string{"*"},
+		handler: handler,
+		except:  except,
+	})
+}
+
+// HandleMethods registers a separate handler for each method on pattern.
+// handlers maps a method, like "GET", to the handler for that method.
+// Requests with other methods get a 405, and OPTIONS requests list the
+// methods in handlers.
+func (h *RegexpHandler) HandleMethods(pattern *regexp.Regexp, handlers map[string]http.Handler) {
+	methodHandlers := make(map[string]http.Handler, len(handlers))
+	methods := make([]string, 0, len(handlers))
+	for method, handler := range handlers {
+		method = strings.ToUpper(method)
+		methodHandlers[method] = handler
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	h.addRoute(&route{
+		pattern:        pattern,
+		methods:        methods,
+		methodHandlers: methodHandlers,
+	})
+}
+
+// HandleExactPath registers handler for requests whose path is exactly
+// path, for example "/healthz". The path is compared as a plain string, so
+// characters like "." don't need to be escaped, and no regex is evaluated
+// when serving the request.
+func (h *RegexpHandler) HandleExactPath(path string, methods []string, handler http.Handler) {
+	h.addRoute(&route{
+		pattern: regexp.MustCompile("^" + regexp.QuoteMeta(path) + "$"),
+		methods: methods,
+		handler: handler,
+		literal: path,
+	})
+}
+
+// RouteInfo describes a route registered with a RegexpHandler.
+type RouteInfo struct {
+	Pattern string   `json:"pattern"`
+	Methods []string `json:"methods"`
+}
+
+// Routes returns the registered routes, in the order they're tried. Routes
+// that accept any method list the methods sent in the Allow header.
+func (h *RegexpHandler) Routes() []RouteInfo {
+	routes := h.getRoutes()
+	infos := make([]RouteInfo, len(routes))
+	for i, route := range routes {
+		infos[i] = RouteInfo{
+			Pattern: route.pattern.String(),
+			Methods: route.allowedMethods(),
+		}
+	}
+	return infos
+}
+
+// RouteTableHandler serves the routes registered with h as a JSON array, for
+// example at /debug/routes, to help debug which routes a deployed server
+// has. Each request lists the routes registered at that moment.
+func RouteTableHandler(h *RegexpHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(h.Routes())
+	})
+}
+
+// Matches reports whether any route matches path, whatever its method, so
+// ServeHTTP wouldn't return a 404 for it. It's useful for checking that
+// links point at real routes. path may include a query string, which
+// routes registered with HandleQuery check; it's otherwise compared like a
+// request's decoded URL.Path. The fallbacks set with SetFallback aren't
+// considered.
+func (h *RegexpHandler) Matches(path string) bool {
+	u := &url.URL{Path: path}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		u.Path, u.RawQuery = path[:i], path[i+1:]
+	}
+	rt := h.matchRoute(&http.Request{URL: u})
+	if rt == nil {
+		return false
+	}
+	if sub, ok := rt.mounted.(*RegexpHandler); ok {
+		return sub.Matches(stripMountPrefix(path, rt.mountPrefix))
+	}
+	return true
+}
+
+// matchRoute returns the first route that matches r's path, or nil if no
+// route matches. The request method is not considered.
+func (h *RegexpHandler) matchRoute(r *http.Request) *route {
+	for _, route := range h.getRoutes() {
+		if route.matches(r) {
+			return route
+		}
+	}
+	return nil
+}
+
+// key identifies the requests a route matches. Routes with the same key
+// match exactly the same requests, and differ only in the methods they
+// accept.
+func (rt *route) key() string {
+	return rt.pattern.String() + "\x00" + rt.queryKey + "\x00" + rt.queryValue
+}
+
+// acceptsAny reports whether rt and other accept at least one method in
+// common, for the same media type.
+func (rt *route) acceptsAny(other *route) bool {
+	if rt.mediaType != other.mediaType {
+		return false
+	}
+	if rt.wildcard() && other.wildcard() {
+		return true
+	}
+	if other.wildcard() {
+		rt, other = other, rt
+	}
+	for _, m := range other.methods {
+		if rt.handlerFor(strings.ToUpper(m)) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// handles reports whether a route with the same key as rt serves method,
+// rather than giving a 405 or an OPTIONS response.
+func (h *RegexpHandler) handles(rt *route, method string) bool {
+	if rt.handlerFor(method) != nil {
+		return true
+	}
+	for _, sibling := range h.siblings(rt) {
+		if sibling.handlerFor(method) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// siblings returns the routes registered for the same requests as rt,
+// including rt, in the order they're tried.
+func (h *RegexpHandler) siblings(rt *route) []*route {
+	key := rt.key()
+	var routes []*route
+	for _, other := range h.getRoutes() {
+		if other == rt || (other.key() == key && other.active()) {
+			routes = append(routes, other)
+		}
+	}
+	return routes
+}
+
+// Validate returns an error if the same pattern has been registered more
+// than once with overlapping methods. Only the first of those routes is
+// ever called for the overlapping methods, which usually means a route was
+// registered twice by mistake. Call Validate after registering routes, so a
+// misconfiguration is caught at startup.
+//
+// Registering the same pattern more than once with different methods is
+// fine; the routes are treated as one, and a request is served by whichever
+// of them accepts its method.
+func (h *RegexpHandler) Validate() error {
+	routes := h.getRoutes()
+	var errs []error
+	for i, rt := range routes {
+		for _, earlier := range routes[:i] {
+			if earlier.key() == rt.key() && earlier.acceptsAny(rt) {
+				errs = append(errs, fmt.Errorf("server: route %q is registered more than once for the same methods (%s and %s)",
+					rt.pattern.String(), strings.Join(earlier.allowedMethods(), ", "), strings.Join(rt.allowedMethods(), ", ")))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// serveRoute applies rt's body size limit, calls the BeforeMatch hook, if
+// there is one, and then handler. r must already carry the route match.
+func (h *RegexpHandler) serveRoute(w http.ResponseWriter, r *http.Request, rt *route, handler http.Handler) {
+	limit := rt.maxBodyBytes
+	if limit <= 0 {
+		limit = h.MaxBodyBytes
+	}
+	if limit > 0 && r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength > limit {
+			WriteError(w, newRequestTooLarge(r, limit))
 			return
 		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	if h.BeforeMatch != nil && !h.BeforeMatch(w, r) {
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+func (h *RegexpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serveMatched(w, r, h.matchRoute(r))
+}
+
+// serveMatched serves r with route, the result of h.matchRoute(r), so
+// middleware that has already matched the request doesn't match it again.
+func (h *RegexpHandler) serveMatched(w http.ResponseWriter, r *http.Request, route *route) {
+	if route == nil {
+		if h.DebugRoutes {
+			w.Header().Set("X-Matched-Route", "none")
+		}
+		if fallback := h.getFallback(r.Method); fallback != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		if h.HTMLNotFound != nil && prefersHTML(r) {
+			h.HTMLNotFound.ServeHTTP(w, r)
+			return
+		}
+		WriteError(w, new404(r))
+		return
+	}
+	if h.DebugRoutes {
+		w.Header().Set("X-Matched-Route", route.pattern.String())
+	}
+	upperMethod := strings.ToUpper(r.Method)
+	if !route.negotiated.Load() {
+		if handler := route.handlerFor(upperMethod); handler != nil {
+			h.serveRoute(w, withRouteMatch(r, route), route, handler)
+			return
+		}
+	}
+	// Another route may have been registered for the same pattern with
+	// different methods or media types.
+	siblings := h.siblings(route)
+	if route.negotiated.Load() {
+		for _, sibling := range siblings {
+			if sibling.mediaType != "" {
+				w.Header().Add("Vary", "Accept")
+				break
+			}
+		}
+	}
+	rt, handler, acceptable := negotiate(r, siblings, upperMethod)
+	if rt != nil {
+		h.serveRoute(w, withRouteMatch(r, rt), rt, handler)
+		return
+	}
+	if !acceptable {
+		var types []string
+		for _, sibling := range siblings {
+			if sibling.mediaType != "" && sibling.handlerFor(upperMethod) != nil {
+				types = append(types, sibling.mediaType)
+			}
+		}
+		WriteError(w, &Error{
+			Title:      "Not acceptable",
+			Id:         "not_acceptable",
+			Detail:     "This resource can only return " + strings.Join(types, ", "),
+			Instance:   r.URL.Path,
+			StatusCode: http.StatusNotAcceptable,
+		})
+		return
+	}
+	var methods []string
+	seen := make(map[string]bool)
+	for _, sibling := range siblings {
+		for _, m := range sibling.allowedMethods() {
+			if !seen[strings.ToUpper(m)] {
+				seen[strings.ToUpper(m)] = true
+				methods = append(methods, m)
+			}
+		}
+	}
+	methods = append(methods, "OPTIONS")
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	if upperMethod == "OPTIONS" {
+		if h.DescriptiveOptions {
+			params := []string{}
+			for _, name := range route.pattern.SubexpNames() {
+				if name != "" {
+					params = append(params, name)
+				}
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(map[string][]string{
+				"methods":     methods,
+				"path_params": params,
+			})
+		}
+		return
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusNotFound)
-	json.NewEncoder(w).Encode(new404(r))
+	e := new405(r)
+	e.AllowedMethods = methods
+	WriteError(w, e)
 }
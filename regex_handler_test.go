@@ -1,8 +1,18 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp/syntax"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/Shyp/go-servers/test"
@@ -37,3 +47,796 @@ func TestOptionsAllowHeader(t *testing.T) {
 	header := w.Header()
 	test.AssertEquals(t, header.Get("Allow"), "GET, OPTIONS")
 }
+
+func TestBuildExactRoute(t *testing.T) {
+	route := BuildExactRoute(`/v1/jobs`)
+	test.Assert(t, route.MatchString("/v1/jobs"), "expected exact path to match")
+	test.Assert(t, !route.MatchString("/v1/jobs/123"), "expected longer path not to match")
+	test.Assert(t, !route.MatchString("/api/v1/jobs"), "expected prefixed path not to match")
+
+	route = BuildExactRoute(`/a|/b`)
+	test.Assert(t, !route.MatchString("/a/c"), "expected alternation to be anchored")
+}
+
+func TestHandleExact(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HandleExact(`/v1/jobs/(?P<Id>[^\s\/]+)`, []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("job"))
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs/123/extra", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/jobs/123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestHandleExactPath(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HandleExactPath("/robots.txt", []string{"GET"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *"))
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/robots.txt", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Body.String(), "User-agent: *")
+
+	// The dot should not match any character.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/robotsXtxt", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+}
+
+func TestHandleContentType(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HandleContentType(BuildRoute(`^/v1/jobs\.csv$`), []string{"GET"}, "text/csv", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("id,name\n"))
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs.csv", nil)
+	JSONMiddleware(h).ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "text/csv")
+}
+
+func TestRemovableRoute(t *testing.T) {
+	h := new(RegexpHandler)
+	handle := h.AddRemovableRoute(BuildRoute(`^/v1/beta$`), []string{"GET"}, okHandler)
+	h.Handler(BuildRoute(`^/v1$`), []string{"GET"}, okHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/v1/beta", nil)
+			h.ServeHTTP(w, req)
+		}()
+	}
+	handle.Remove()
+	handle.Remove()
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/beta", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestToggledExpvarMiddleware(t *testing.T) {
+	var enabled atomic.Bool
+	h := ToggledExpvarMiddleware(new(RegexpHandler), "", &enabled)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/vars", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+
+	enabled.Store(true)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertContains(t, w.Body.String(), "memstats")
+}
+
+func TestToggledPprofMiddleware(t *testing.T) {
+	var enabled atomic.Bool
+	h := ToggledPprofMiddleware(new(RegexpHandler), "", &enabled)
+	req, _ := http.NewRequest("GET", "/debug/pprof/cmdline", nil)
+	for _, on := range []bool{false, true, false} {
+		enabled.Store(on)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if on {
+			test.AssertEquals(t, w.Code, http.StatusOK)
+			test.AssertContains(t, w.Body.String(), os.Args[0])
+		} else {
+			test.AssertEquals(t, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestHandleQuery(t *testing.T) {
+	h := new(RegexpHandler)
+	route := BuildRoute(`^/search$`)
+	h.HandleQuery(route, []string{"GET"}, "type", "jobs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jobs"))
+	}))
+	h.HandleFunc(route, []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("default"))
+	})
+	for query, want := range map[string]string{"?type=jobs": "jobs", "?type=users": "default", "": "default"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/search"+query, nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Body.String(), want)
+	}
+}
+
+func TestHTMLNotFound(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HTMLNotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<h1>Not found</h1>"))
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+	test.AssertEquals(t, w.Body.String(), "<h1>Not found</h1>")
+
+	for _, accept := range []string{"", "application/json", "*/*"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/missing", nil)
+		req.Header.Set("Accept", accept)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusNotFound)
+		test.AssertContains(t, w.Body.String(), "not_found")
+	}
+}
+
+func TestDebugRoutes(t *testing.T) {
+	h := new(RegexpHandler)
+	h.DebugRoutes = true
+	route := BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`)
+	h.Handler(route, []string{"GET"}, okHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs/123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("X-Matched-Route"), route.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/users", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("X-Matched-Route"), "none")
+}
+
+func TestHandleMethods(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HandleMethods(BuildRoute(`^/v1/jobs$`), map[string]http.Handler{
+		"GET": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("list"))
+		}),
+		"post": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("create"))
+		}),
+	})
+	for method, want := range map[string]string{"GET": "list", "POST": "create"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/v1/jobs", nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Body.String(), want)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusMethodNotAllowed)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Allow"), "GET, POST, OPTIONS")
+}
+
+// captureStderr returns everything written to os.Stderr while fn runs.
+func captureStderr(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	test.AssertNotError(t, err, "creating pipe")
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	fn()
+	w.Close()
+	out, err := io.ReadAll(r)
+	test.AssertNotError(t, err, "reading pipe")
+	return string(out)
+}
+
+func TestDebugRequestBodyRedactsHeaders(t *testing.T) {
+	t.Setenv("DEBUG_HTTP_TRAFFIC", "true")
+	var body string
+	h := DebugRequestBodyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Header().Set("Set-Cookie", "session=abc123")
+		w.Write([]byte("ok"))
+	}))
+	out := captureStderr(t, func() {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"name": "job"}`))
+		req.Header.Set("Authorization", "Bearer supersecret")
+		req.Header.Set("X-Custom", "visible")
+		h.ServeHTTP(w, req)
+	})
+	test.AssertEquals(t, body, `{"name": "job"}`)
+	test.AssertNotContains(t, out, "supersecret")
+	test.AssertNotContains(t, out, "abc123")
+	test.AssertContains(t, out, "Authorization: [REDACTED]")
+	test.AssertContains(t, out, "X-Custom: visible")
+	test.AssertContains(t, out, `{"name": "job"}`)
+}
+
+func TestDebugRequestBodyRedactsQuery(t *testing.T) {
+	t.Setenv("DEBUG_HTTP_TRAFFIC", "true")
+	var query string
+	h := DebugRequestBodyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+	}))
+	out := captureStderr(t, func() {
+		req, _ := http.NewRequest("GET", "/v1/jobs?limit=10&access_token=supersecret", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	})
+	test.AssertEquals(t, query, "limit=10&access_token=supersecret")
+	test.AssertNotContains(t, out, "supersecret")
+	test.AssertContains(t, out, "GET /v1/jobs?access_token=[REDACTED]&limit=10 HTTP/1.1")
+}
+
+func TestDebugRequestBodyWithLabels(t *testing.T) {
+	t.Setenv("DEBUG_HTTP_TRAFFIC", "true")
+	h := RequestIDMiddleware(DebugRequestBodyMiddlewareWithLabels(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Custom", "visible")
+		w.Write([]byte("ok"))
+	})))
+	var w *httptest.ResponseRecorder
+	out := captureStderr(t, func() {
+		for i := 0; i < 2; i++ {
+			w = httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+			req.Header.Set(RequestIDHeader, fmt.Sprintf("req_%d", i))
+			h.ServeHTTP(w, req)
+		}
+	})
+	test.AssertEquals(t, w.Header().Get("X-Custom"), "visible")
+	first := strings.Index(out, "(id req_0) ---")
+	second := strings.Index(out, "(id req_1) ---")
+	test.Assert(t, first >= 0 && second > first, "expected labeled blocks in order, got "+out)
+	test.AssertContains(t, out, "--- request ")
+}
+
+func TestRedactURLUnchanged(t *testing.T) {
+	u, _ := url.Parse("/v1/jobs?limit=10&b=%20")
+	test.Assert(t, redactURL(u) == u, "expected URL without secrets to be returned as is")
+}
+
+func TestSetFallback(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"GET"}, okHandler)
+	h.SetFallback("GET", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>app</html>"))
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/settings/profile", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Body.String(), "<html>app</html>")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/settings/profile", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+	test.AssertContains(t, w.Body.String(), "not_found")
+
+	h.SetFallback("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusTeapot)
+}
+
+func TestHandleAllExcept(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HandleAllExcept(BuildRoute(`^/proxy/`), []string{"DELETE"}, okHandler)
+	for _, method := range []string{"GET", "POST", "PATCH", "PROPFIND"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/proxy/jobs", nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/proxy/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusMethodNotAllowed)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "/proxy/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Allow"), "GET, HEAD, POST, PUT, PATCH, OPTIONS")
+}
+
+func TestWildcardMethod(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/proxy/`), []string{"*"}, okHandler)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/proxy/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestRegisterAll(t *testing.T) {
+	h := new(RegexpHandler)
+	err := h.RegisterAll([]RouteDef{
+		{Pattern: `^/v1/jobs$`, Methods: []string{"GET"}, Handler: okHandler},
+		{Pattern: `^/v1/jobs/(?P<Id>[^\s\/]+$`, Methods: []string{"GET"}, Handler: okHandler},
+		{Pattern: `^/v1/users/(?P<Id$`, Methods: []string{"GET"}, Handler: okHandler},
+	})
+	test.AssertError(t, err, "expected invalid patterns to fail")
+	test.AssertContains(t, err.Error(), `"^/v1/jobs/(?P<Id>[^\\s\\/]+$"`)
+	test.AssertContains(t, err.Error(), "and 1 more")
+	var syntaxErr *syntax.Error
+	test.Assert(t, errors.As(err, &syntaxErr), "expected error to wrap a *syntax.Error")
+	test.AssertEquals(t, len(h.Routes()), 0)
+
+	err = h.RegisterAll([]RouteDef{
+		{Pattern: `^/v1/jobs$`, Methods: []string{"GET"}, Handler: okHandler},
+		{Pattern: `^/v1/users$`, Methods: []string{"GET"}, Handler: okHandler},
+	})
+	test.AssertNotError(t, err, "registering valid routes")
+	test.AssertEquals(t, len(h.Routes()), 2)
+}
+
+func TestRouteTableHandler(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HandleExactPath("/debug/routes", []string{"GET"}, RouteTableHandler(h))
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"GET", "POST"}, okHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/routes", nil)
+	h.ServeHTTP(w, req)
+	var routes []RouteInfo
+	err := json.Unmarshal(w.Body.Bytes(), &routes)
+	test.AssertNotError(t, err, "decoding route table")
+	test.AssertDeepEquals(t, routes, []RouteInfo{
+		{Pattern: `^/debug/routes$`, Methods: []string{"GET"}},
+		{Pattern: `^/v1/jobs$`, Methods: []string{"GET", "POST"}},
+	})
+}
+
+func TestValidateDuplicateRoutes(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"GET"}, okHandler)
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"POST"}, okHandler)
+	test.AssertNotError(t, h.Validate(), "")
+
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"get", "PUT"}, okHandler)
+	err := h.Validate()
+	test.AssertError(t, err, "expected duplicate GET route to be reported")
+	test.AssertContains(t, err.Error(), `"^/v1/jobs$"`)
+
+	h = new(RegexpHandler)
+	h.HandleAllExcept(BuildRoute(`^/v1/proxy$`), []string{"DELETE"}, okHandler)
+	h.Handler(BuildRoute(`^/v1/proxy$`), []string{"DELETE"}, okHandler)
+	test.AssertNotError(t, h.Validate(), "")
+	h.Handler(BuildRoute(`^/v1/proxy$`), []string{"GET"}, okHandler)
+	test.AssertError(t, h.Validate(), "expected wildcard overlap to be reported")
+}
+
+func TestSamePatternDifferentMethods(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HandleFunc(BuildRoute(`^/v1/jobs$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("list"))
+	})
+	h.HandleFunc(BuildRoute(`^/v1/jobs$`), []string{"POST"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("create"))
+	})
+
+	for _, tt := range []struct {
+		method string
+		code   int
+		body   string
+	}{
+		{"GET", 200, "list"},
+		{"POST", 200, "create"},
+		{"DELETE", 405, "method_not_allowed"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, "/v1/jobs", nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		test.AssertContains(t, w.Body.String(), tt.body)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Allow"), "GET, POST, OPTIONS")
+}
+
+func TestMethodNotAllowedListsMethods(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"GET", "POST"}, okHandler)
+	h.Handler(BuildRoute(`^/v1/users$`), []string{"GET"}, okHandler)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusMethodNotAllowed)
+	test.AssertEquals(t, w.Header().Get("Allow"), "GET, POST, OPTIONS")
+	var e Error
+	test.AssertNotError(t, json.Unmarshal(w.Body.Bytes(), &e), "")
+	test.AssertDeepEquals(t, e.AllowedMethods, []string{"GET", "POST", "OPTIONS"})
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/unknown", nil)
+	h.ServeHTTP(w, req)
+	test.AssertNotContains(t, w.Body.String(), "allowed_methods")
+}
+
+func TestBeforeMatch(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/users/(?P<Id>[^\s\/]+)$`), []string{"GET"}, okHandler)
+	var calls int
+	h.BeforeMatch = func(w http.ResponseWriter, r *http.Request) bool {
+		calls++
+		if Params(r)["Id"] != "usr_123" {
+			WriteError(w, newForbidden(r))
+			return false
+		}
+		return true
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/users/usr_123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Body.String(), "ok")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/users/usr_456", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusForbidden)
+	test.AssertEquals(t, calls, 2)
+
+	// The hook doesn't run for 404s or 405s.
+	for _, path := range []string{"/v1/unknown", "/v1/users/usr_123"} {
+		req, _ = http.NewRequest("POST", path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	test.AssertEquals(t, calls, 2)
+}
+
+func TestMethodSets(t *testing.T) {
+	h := new(RegexpHandler)
+	methods := []string{"GET"}
+	h.Handler(BuildRoute(`^/v1/users$`), methods, okHandler)
+	methods[0] = "POST"
+	read := ReadMethods()
+	read[0] = "DELETE"
+	h.Handler(BuildRoute(`^/v1/jobs$`), ReadMethods(), okHandler)
+	h.Handler(BuildRoute(`^/v1/jobs$`), WriteMethods(), okHandler)
+	test.AssertNotError(t, h.Validate(), "")
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", "/v1/users", 200},
+		{"POST", "/v1/users", 405},
+		{"HEAD", "/v1/jobs", 200},
+		{"PATCH", "/v1/jobs", 200},
+		{"DELETE", "/v1/jobs", 405},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+	}
+}
+
+func TestDescriptiveOptions(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/users/(?P<UserId>[^\s\/]+)/jobs/(?P<Id>[^\s\/]+)$`), []string{"GET", "DELETE"}, okHandler)
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"GET"}, okHandler)
+
+	req, _ := http.NewRequest("OPTIONS", "/v1/users/usr_123/jobs/job_456", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Body.Len(), 0)
+
+	h.DescriptiveOptions = true
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Header().Get("Allow"), "GET, DELETE, OPTIONS")
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	var body map[string][]string
+	test.AssertNotError(t, json.Unmarshal(w.Body.Bytes(), &body), "")
+	test.AssertDeepEquals(t, body["methods"], []string{"GET", "DELETE", "OPTIONS"})
+	test.AssertDeepEquals(t, body["path_params"], []string{"UserId", "Id"})
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Body.String(), "{\"methods\":[\"GET\",\"OPTIONS\"],\"path_params\":[]}\n")
+}
+
+func TestHandlePriority(t *testing.T) {
+	h := new(RegexpHandler)
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	h.Handler(BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`), []string{"GET"}, named("job"))
+	h.Handler(BuildRoute(`^/v1/jobs/.+$`), []string{"GET"}, named("catchall"))
+	h.HandlePriority(10, BuildRoute(`^/v1/jobs/export$`), []string{"GET"}, named("export"))
+	h.HandlePriority(5, BuildRoute(`^/v1/jobs/.+$`), []string{"GET"}, named("five"))
+	h.HandlePriority(10, BuildRoute(`^/v1/jobs/exp.+$`), []string{"GET"}, named("export2"))
+	h.HandlePriority(-1, BuildRoute(`^/v1/.+$`), []string{"GET"}, named("last"))
+
+	patterns := make([]string, 0)
+	for _, info := range h.Routes() {
+		patterns = append(patterns, info.Pattern)
+	}
+	test.AssertDeepEquals(t, patterns, []string{
+		`^/v1/jobs/export$`,
+		`^/v1/jobs/exp.+$`,
+		`^/v1/jobs/.+$`,
+		`^/v1/jobs/(?P<Id>[^\s\/]+)$`,
+		`^/v1/jobs/.+$`,
+		`^/v1/.+$`,
+	})
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{"/v1/jobs/export", "export"},
+		{"/v1/jobs/exports", "export2"},
+		{"/v1/jobs/job_123", "five"},
+		{"/v1/users", "last"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Body.String(), tt.want)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`), []string{"POST"}, okHandler)
+	h.HandleExactPath("/healthz", []string{"GET"}, okHandler)
+	h.HandleQuery(BuildRoute(`^/search$`), []string{"GET"}, "type", "jobs", okHandler)
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"/v1/jobs/job_123", true},
+		{"/v1/jobs", false},
+		{"/healthz", true},
+		{"/search?type=jobs", true},
+		{"/search?type=users", false},
+		{"/search", false},
+	} {
+		test.AssertEquals(t, h.Matches(tt.path), tt.want)
+	}
+}
+
+func TestHandleWithMaxBodyBytes(t *testing.T) {
+	var readErr error
+	reader := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	})
+	h := &RegexpHandler{MaxBodyBytes: 10}
+	h.HandleWithMaxBodyBytes(BuildRoute(`^/v1/uploads$`), []string{"POST"}, 100, reader)
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"POST"}, reader)
+	test.AssertNotError(t, h.RegisterAll([]RouteDef{
+		{Pattern: `^/v1/big$`, Methods: []string{"POST"}, Handler: reader, MaxBodyBytes: 1000},
+	}), "")
+
+	for _, tt := range []struct {
+		path    string
+		size    int
+		chunked bool
+		code    int
+		readErr bool
+	}{
+		{"/v1/uploads", 50, false, 200, false},
+		{"/v1/uploads", 150, false, 413, false},
+		{"/v1/uploads", 150, true, 200, true},
+		{"/v1/jobs", 5, false, 200, false},
+		{"/v1/jobs", 50, false, 413, false},
+		{"/v1/big", 500, false, 200, false},
+	} {
+		readErr = nil
+		w := httptest.NewRecorder()
+		var body io.Reader = strings.NewReader(strings.Repeat("a", tt.size))
+		if tt.chunked {
+			body = io.NopCloser(body)
+		}
+		req, _ := http.NewRequest("POST", tt.path, body)
+		if tt.chunked {
+			req.ContentLength = -1
+		}
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		if tt.code == 413 {
+			test.AssertErrorResponse(t, w, 413, "request_too_large")
+		}
+		test.AssertEquals(t, readErr != nil, tt.readErr)
+	}
+}
+
+func TestHandleAccept(t *testing.T) {
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	h := new(RegexpHandler)
+	h.HandleAccept(BuildRoute(`^/v1/reports$`), []string{"GET"}, "application/json", named("json"))
+	h.HandleAccept(BuildRoute(`^/v1/reports$`), []string{"GET"}, "text/csv", named("csv"))
+	test.AssertNotError(t, h.Validate(), "")
+
+	for _, tt := range []struct {
+		accept string
+		code   int
+		body   string
+		ctype  string
+	}{
+		{"", 200, "json", "application/json"},
+		{"text/csv", 200, "csv", "text/csv"},
+		{"application/json;q=0.5, text/csv;q=0.9", 200, "csv", "text/csv"},
+		{"text/*", 200, "csv", "text/csv"},
+		{"*/*", 200, "json", "application/json"},
+		{"image/png", 406, "not_acceptable", "application/json; charset=utf-8"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/reports", nil)
+		req.Header.Set("Accept", tt.accept)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		test.AssertContains(t, w.Body.String(), tt.body)
+		test.AssertEquals(t, w.Header().Get("Content-Type"), tt.ctype)
+		test.AssertEquals(t, w.Header().Get("Vary"), "Accept")
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/reports", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusMethodNotAllowed)
+
+	// A route without a media type handles everything else.
+	h.Handler(BuildRoute(`^/v1/reports$`), []string{"GET"}, named("plain"))
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/reports", nil)
+	req.Header.Set("Accept", "image/png")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Body.String(), "plain")
+}
+
+func TestHandleIf(t *testing.T) {
+	var enabled atomic.Bool
+	h := new(RegexpHandler)
+	h.HandleIf(enabled.Load, BuildRoute(`^/v2/jobs$`), []string{"GET"}, okHandler)
+	h.HandleIf(enabled.Load, BuildRoute(`^/v1/jobs$`), []string{"POST"}, okHandler)
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"GET"}, okHandler)
+
+	serve := func(method, path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	test.AssertEquals(t, serve("GET", "/v2/jobs"), http.StatusNotFound)
+	test.AssertEquals(t, serve("POST", "/v1/jobs"), http.StatusMethodNotAllowed)
+	test.Assert(t, !h.Matches("/v2/jobs"), "expected disabled route not to match")
+
+	enabled.Store(true)
+	test.AssertEquals(t, serve("GET", "/v2/jobs"), http.StatusOK)
+	test.AssertEquals(t, serve("POST", "/v1/jobs"), http.StatusOK)
+	test.Assert(t, h.Matches("/v2/jobs"), "expected enabled route to match")
+}
+
+func TestMount(t *testing.T) {
+	v2 := new(RegexpHandler)
+	var pattern, id, path string
+	v2.HandleFunc(BuildRoute(`^/jobs/(?P<Id>[^\s\/]+)$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		pattern = MatchedPattern(r)
+		id = Params(r)["Id"]
+		path = r.URL.Path
+	})
+	v2.HandleFunc(BuildRoute(`^/$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("root"))
+	})
+	parent := new(RegexpHandler)
+	parent.Mount("/v2/", v2)
+	parent.Handler(BuildRoute(`^/v2jobs$`), []string{"GET"}, okHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v2/jobs/job_123", nil)
+	parent.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, pattern, `^/jobs/(?P<Id>[^\s\/]+)$`)
+	test.AssertEquals(t, id, "job_123")
+	test.AssertEquals(t, path, "/jobs/job_123")
+	test.AssertEquals(t, req.URL.Path, "/v2/jobs/job_123")
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/v2", 200, "root"},
+		{"GET", "/v2/", 200, "root"},
+		{"GET", "/v2jobs", 200, "ok"},
+		{"GET", "/v2/unknown", 404, "not_found"},
+		{"DELETE", "/v2/jobs/job_123", 405, "method_not_allowed"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		parent.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		test.AssertContains(t, w.Body.String(), tt.body)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "/v2/jobs/job_123", nil)
+	parent.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Allow"), "GET, OPTIONS")
+
+	test.Assert(t, parent.Matches("/v2/jobs/job_123"), "expected mounted route to match")
+	test.Assert(t, !parent.Matches("/v2/unknown"), "expected unknown mounted path not to match")
+}
+
+func TestHandleAcceptOnlyNegotiatesItsOwnRoutes(t *testing.T) {
+	h := new(RegexpHandler)
+	h.Handler(BuildRoute(`^/v1/reports$`), []string{"GET"}, okHandler)
+	h.Handler(BuildRoute(`^/v1/jobs$`), []string{"GET"}, okHandler)
+	h.HandleAccept(BuildRoute(`^/v1/reports$`), []string{"GET"}, "text/csv", okHandler)
+	h.Handler(BuildRoute(`^/v1/reports$`), []string{"POST"}, okHandler)
+
+	for _, rt := range h.getRoutes() {
+		want := rt.pattern.String() == `^/v1/reports$`
+		test.AssertEquals(t, rt.negotiated.Load(), want)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Header().Get("Vary"), "")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/reports", nil)
+	req.Header.Set("Accept", "text/csv")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "text/csv")
+	test.AssertEquals(t, w.Header().Get("Vary"), "Accept")
+}
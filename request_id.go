@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header RequestIDMiddleware reads the request ID
+// from, and writes it to in the response.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength is the longest request ID that will be accepted from a
+// client or load balancer; longer IDs are replaced.
+const maxRequestIDLength = 200
+
+// RequestIDMiddleware assigns each request an ID, available to handlers
+// through RequestID. If the request has an X-Request-Id header (for example,
+// set by a load balancer) that value is used, otherwise a random ID is
+// generated. The ID is also sent back in the X-Request-Id response header,
+// and included in the request_id field of errors written with WriteError,
+// which reads it from that header.
+func RequestIDMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// RequestID returns the ID assigned to r by RequestIDMiddleware, or the
+// empty string if there isn't one.
+func RequestID(r *http.Request) string {
+	return RequestIDFromContext(r.Context())
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID id, which can
+// be read back with RequestIDFromContext. Use it to pass a request ID along
+// to work done outside the request, like a background job.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID in ctx, or the empty string if
+// there isn't one.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
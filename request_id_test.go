@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var id string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestID(r)
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, len(id), 32)
+	test.AssertEquals(t, w.Header().Get("X-Request-Id"), id)
+
+	w = httptest.NewRecorder()
+	req.Header.Set("X-Request-Id", "lb-1234")
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, id, "lb-1234")
+}
+
+func TestRequestIDInErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	req.Header.Set("X-Request-Id", "lb-1234")
+	RequestIDMiddleware(new(RegexpHandler)).ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNotFound)
+	test.AssertContains(t, w.Body.String(), `"request_id":"lb-1234"`)
+
+	w = httptest.NewRecorder()
+	new(RegexpHandler).ServeHTTP(w, req)
+	test.AssertNotContains(t, w.Body.String(), "request_id")
+}
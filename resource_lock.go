@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultResourceLockTimeout is how long ResourceLockMiddleware waits for
+// another write to the same resource to finish.
+const DefaultResourceLockTimeout = 5 * time.Second
+
+// keyedLock is a set of mutexes, one for each key in use. A key's mutex is
+// removed once nothing holds or is waiting for it.
+type keyedLock struct {
+	mu    sync.Mutex
+	locks map[string]*resourceLock
+}
+
+type resourceLock struct {
+	ch   chan struct{} // holds a value while the lock is held
+	refs int
+}
+
+func newKeyedLock() *keyedLock {
+	return &keyedLock{locks: make(map[string]*resourceLock)}
+}
+
+// acquire waits up to timeout, or until done is closed, for the lock for key.
+// If it returns true, the caller holds the lock and must call release.
+func (k *keyedLock) acquire(key string, timeout time.Duration, done <-chan struct{}) bool {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &resourceLock{ch: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case l.ch <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-done:
+	}
+	k.unref(key, l)
+	return false
+}
+
+func (k *keyedLock) release(key string) {
+	k.mu.Lock()
+	l := k.locks[key]
+	k.mu.Unlock()
+	<-l.ch
+	k.unref(key, l)
+}
+
+func (k *keyedLock) unref(key string, l *resourceLock) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(k.locks, key)
+	}
+}
+
+// ResourceLockMiddleware serializes writes to the same resource. keyFn
+// identifies the resource a request changes, for example the job ID from the
+// path; while h is serving a POST, PUT, PATCH or DELETE request for a
+// resource, other write requests for it wait. A request that waits longer
+// than DefaultResourceLockTimeout gets a 409 error. Requests for different
+// resources proceed concurrently.
+//
+// Other methods, and requests for which keyFn returns the empty string, are
+// not locked. The locks are held in memory, so they don't serialize writes
+// handled by other servers.
+func ResourceLockMiddleware(h http.Handler, keyFn func(*http.Request) string) http.Handler {
+	return ResourceLockMiddlewareWithTimeout(h, keyFn, DefaultResourceLockTimeout)
+}
+
+// ResourceLockMiddlewareWithTimeout is like ResourceLockMiddleware, but
+// waits up to timeout for the lock.
+func ResourceLockMiddlewareWithTimeout(h http.Handler, keyFn func(*http.Request) string, timeout time.Duration) http.Handler {
+	return resourceLockMiddleware(h, keyFn, timeout, newKeyedLock())
+}
+
+func resourceLockMiddleware(h http.Handler, keyFn func(*http.Request) string, timeout time.Duration, locks *keyedLock) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.ToUpper(r.Method) {
+		case "POST", "PUT", "PATCH", "DELETE":
+		default:
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := keyFn(r)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !locks.acquire(key, timeout, r.Context().Done()) {
+			WriteError(w, &Error{
+				Title:      "Resource locked",
+				Id:         "resource_locked",
+				Detail:     "Another request is changing this resource. Please try again",
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusConflict,
+			})
+			return
+		}
+		defer locks.release(key)
+		h.ServeHTTP(w, r)
+	})
+}
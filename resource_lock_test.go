@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestResourceLockSerializesWrites(t *testing.T) {
+	var mu sync.Mutex
+	active := make(map[string]int)
+	maxActive := make(map[string]int)
+	h := ResourceLockMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active[r.URL.Path]++
+		if active[r.URL.Path] > maxActive[r.URL.Path] {
+			maxActive[r.URL.Path] = active[r.URL.Path]
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		active[r.URL.Path]--
+		mu.Unlock()
+	}), func(r *http.Request) string { return r.URL.Path })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, path := range []string{"/v1/jobs/a", "/v1/jobs/b"} {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("PUT", path, nil)
+				h.ServeHTTP(w, req)
+				test.AssertEquals(t, w.Code, http.StatusOK)
+			}(path)
+		}
+	}
+	wg.Wait()
+	test.AssertEquals(t, maxActive["/v1/jobs/a"], 1)
+	test.AssertEquals(t, maxActive["/v1/jobs/b"], 1)
+}
+
+func TestResourceLockTimeout(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := ResourceLockMiddlewareWithTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			close(started)
+			<-release
+		}
+	}), func(r *http.Request) string { return "job_123" }, 20*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest("POST", "/v1/jobs/job_123", nil)
+		req.Header.Set("X-Block", "true")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	<-started
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs/job_123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertErrorResponse(t, w, http.StatusConflict, "resource_locked")
+
+	// Reads aren't locked.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/jobs/job_123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	close(release)
+	<-done
+}
+
+func TestResourceLockReleasedOnPanic(t *testing.T) {
+	locks := newKeyedLock()
+	calls := 0
+	h := resourceLockMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		panic("boom")
+	}), func(r *http.Request) string { return "job_123" }, time.Second, locks)
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() { recover() }()
+			req, _ := http.NewRequest("POST", "/v1/jobs/job_123", nil)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	test.AssertEquals(t, calls, 2)
+	test.AssertEquals(t, len(locks.locks), 0)
+}
+
+func TestResourceLockLowercaseMethod(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := ResourceLockMiddlewareWithTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			close(started)
+			<-release
+		}
+	}), func(r *http.Request) string { return "job_123" }, 20*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest("PUT", "/v1/jobs/job_123", nil)
+		req.Header.Set("X-Block", "true")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	<-started
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("put", "/v1/jobs/job_123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertErrorResponse(t, w, http.StatusConflict, "resource_locked")
+	close(release)
+	<-done
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// streamFlushInterval is the number of array items StreamJSONArray writes
+// between flushes.
+const streamFlushInterval = 100
+
+// StreamJSONArray writes the values received on items to w as a JSON array,
+// encoding each item as it arrives instead of buffering the entire list in
+// memory. The array is closed when items is closed.
+//
+// Once streaming starts, a 200 status has already been sent to the client,
+// so an encoding error can't be reported with a different status code. If
+// an item fails to encode, StreamJSONArray stops writing and returns the
+// error, leaving the client with a truncated (invalid) JSON document. The
+// caller is responsible for stopping whatever is sending on items.
+func StreamJSONArray(w http.ResponseWriter, items <-chan interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if _, err := w.Write([]byte{'['}); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	i := 0
+	for item := range items {
+		if i > 0 {
+			if _, err := w.Write([]byte{','}); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		i++
+		if flusher != nil && i%streamFlushInterval == 0 {
+			flusher.Flush()
+		}
+	}
+	if _, err := w.Write([]byte{']'}); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// WriteJSON writes v to w as JSON with the given status code. The
+// Content-Type is set to application/json unless it's already set. It
+// returns the error from encoding v; by then the status has been sent, so
+// the error can only be logged.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) error {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// NoContent writes a 204 No Content response. Any Content-Type header set by
+// earlier middleware is removed, since a 204 response has no body.
+func NoContent(w http.ResponseWriter) {
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Created writes a 201 Created response, with the Location header set to
+// location and body encoded as JSON.
+func Created(w http.ResponseWriter, location string, body interface{}) {
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Redirect redirects the client to newPath with the given status, for
+// example http.StatusMovedPermanently. Unlike http.Redirect, the body is a
+// JSON object with the new location, for API clients that read the body
+// instead of following the Location header:
+//
+//	{"location": "/v2/jobs"}
+func Redirect(w http.ResponseWriter, r *http.Request, newPath string, status int) {
+	w.Header().Set("Location", newPath)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		json.NewEncoder(w).Encode(map[string]string{"location": newPath})
+	}
+}
+
+// ServeContent serves content like http.ServeContent, including support for
+// Range and conditional requests, so clients can resume large downloads.
+// The Content-Type is sniffed from content unless it's already set. Unlike
+// http.ServeContent, a Range header that can't be satisfied gets a JSON 416
+// Error instead of a plain text one; the Content-Range header still gives
+// the size of the content.
+func ServeContent(w http.ResponseWriter, r *http.Request, modtime time.Time, content io.ReadSeeker) {
+	http.ServeContent(&rangeErrorWriter{ResponseWriter: w, r: r}, r, "", modtime, content)
+}
+
+// rangeErrorWriter replaces the plain text body http.ServeContent writes
+// for an unsatisfiable range with an Error.
+type rangeErrorWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+	discard     bool
+}
+
+func (w *rangeErrorWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code != http.StatusRequestedRangeNotSatisfiable {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.discard = true
+	WriteError(w.ResponseWriter, &Error{
+		Title:      "Requested range not satisfiable",
+		Id:         "range_not_satisfiable",
+		Detail:     "The Range header does not overlap the content",
+		Instance:   w.r.URL.Path,
+		StatusCode: http.StatusRequestedRangeNotSatisfiable,
+	})
+}
+
+func (w *rangeErrorWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *rangeErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
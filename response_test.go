@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestStreamJSONArray(t *testing.T) {
+	items := make(chan interface{})
+	go func() {
+		for i := 0; i < 250; i++ {
+			items <- map[string]int{"id": i}
+		}
+		close(items)
+	}()
+	w := httptest.NewRecorder()
+	err := StreamJSONArray(w, items)
+	test.AssertNotError(t, err, "streaming")
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	var out []map[string]int
+	err = json.Unmarshal(w.Body.Bytes(), &out)
+	test.AssertNotError(t, err, "decoding streamed array")
+	test.AssertEquals(t, len(out), 250)
+	test.AssertEquals(t, out[249]["id"], 249)
+}
+
+func TestStreamJSONArrayEmpty(t *testing.T) {
+	items := make(chan interface{})
+	close(items)
+	w := httptest.NewRecorder()
+	test.AssertNotError(t, StreamJSONArray(w, items), "streaming")
+	test.AssertEquals(t, w.Body.String(), "[]")
+}
+
+func TestNoContent(t *testing.T) {
+	h := JSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NoContent(w)
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/v1/jobs/123", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusNoContent)
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "")
+	test.AssertEquals(t, w.Body.Len(), 0)
+}
+
+func TestCreated(t *testing.T) {
+	w := httptest.NewRecorder()
+	Created(w, "/v1/jobs/123", map[string]string{"id": "123"})
+	test.AssertEquals(t, w.Code, http.StatusCreated)
+	test.AssertEquals(t, w.Header().Get("Location"), "/v1/jobs/123")
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	test.AssertEquals(t, w.Body.String(), "{\"id\":\"123\"}\n")
+}
+
+func TestRedirect(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+	Redirect(w, req, "/v2/jobs", http.StatusMovedPermanently)
+	test.AssertEquals(t, w.Code, http.StatusMovedPermanently)
+	test.AssertEquals(t, w.Header().Get("Location"), "/v2/jobs")
+	test.AssertEquals(t, w.Body.String(), "{\"location\":\"/v2/jobs\"}\n")
+}
+
+func TestServeContentRange(t *testing.T) {
+	modtime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/reports/123", nil)
+	req.Header.Set("Range", "bytes=6-")
+	ServeContent(w, req, modtime, strings.NewReader("hello world"))
+	test.AssertEquals(t, w.Code, http.StatusPartialContent)
+	test.AssertEquals(t, w.Body.String(), "world")
+	test.AssertEquals(t, w.Header().Get("Content-Range"), "bytes 6-10/11")
+}
+
+func TestServeContentUnsatisfiableRange(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/reports/123", nil)
+	req.Header.Set("Range", "bytes=100-")
+	ServeContent(w, req, time.Time{}, strings.NewReader("hello world"))
+	test.AssertEquals(t, w.Code, http.StatusRequestedRangeNotSatisfiable)
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	test.AssertEquals(t, w.Header().Get("Content-Range"), "bytes */11")
+	var e Error
+	test.AssertNotError(t, json.Unmarshal(w.Body.Bytes(), &e), "")
+	test.AssertEquals(t, e.Id, "range_not_satisfiable")
+}
+
+func TestWriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := WriteJSON(w, http.StatusAccepted, map[string]string{"id": "job_123"})
+	test.AssertNotError(t, err, "")
+	test.AssertEquals(t, w.Code, http.StatusAccepted)
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	test.AssertEquals(t, w.Body.String(), "{\"id\":\"job_123\"}\n")
+
+	w = httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	WriteJSON(w, http.StatusOK, []int{1})
+	test.AssertEquals(t, w.Header().Get("Content-Type"), "application/vnd.api+json")
+
+	w = httptest.NewRecorder()
+	err = WriteJSON(w, http.StatusOK, make(chan int))
+	test.AssertError(t, err, "expected an encoding error")
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// RewriteRule rewrites request paths that match Source. Replacement can
+// refer to Source's capture groups with $1 or ${name}, as in
+// regexp.Regexp.ReplaceAllString.
+type RewriteRule struct {
+	Source      *regexp.Regexp
+	Replacement string
+}
+
+// RewriteMiddleware rewrites the path of each request with the first rule in
+// rules whose Source matches it, before calling h. Rules are tried in order,
+// and at most one rule is applied. Place it in front of a RegexpHandler to
+// serve legacy paths with the current handlers:
+//
+//	rules := []server.RewriteRule{{
+//		Source:      regexp.MustCompile(`^/v0/job/(?P<Id>[^\s\/]+)$`),
+//		Replacement: "/v1/jobs/${Id}",
+//	}}
+//	http.ListenAndServe(":8080", server.RewriteMiddleware(h, rules))
+func RewriteMiddleware(h http.Handler, rules []RewriteRule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules {
+			if !rule.Source.MatchString(r.URL.Path) {
+				continue
+			}
+			r2 := new(http.Request)
+			*r2 = *r
+			u := *r.URL
+			u.Path = rule.Source.ReplaceAllString(r.URL.Path, rule.Replacement)
+			u.RawPath = ""
+			r2.URL = &u
+			h.ServeHTTP(w, r2)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestRewriteMiddleware(t *testing.T) {
+	h := new(RegexpHandler)
+	h.HandleFunc(BuildRoute(`^/v1/jobs/(?P<Id>[^\s\/]+)$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Params(r)["Id"]))
+	})
+	rules := []RewriteRule{
+		{Source: regexp.MustCompile(`^/v0/job/(?P<Id>[^\s\/]+)$`), Replacement: "/v1/jobs/${Id}"},
+		{Source: regexp.MustCompile(`^/legacy/job/([^\s\/]+)$`), Replacement: "/v1/jobs/$1"},
+		{Source: regexp.MustCompile(`^/legacy/`), Replacement: "/unused/"},
+	}
+	rewritten := RewriteMiddleware(h, rules)
+	for _, path := range []string{"/v0/job/123", "/legacy/job/123", "/v1/jobs/123"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		rewritten.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+		test.AssertEquals(t, w.Body.String(), "123")
+		test.AssertEquals(t, req.URL.Path, path)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SequenceHeader is the request header SequenceMiddleware reads.
+const SequenceHeader = "X-Sequence"
+
+// sequenceIdleTimeout is how long SequenceMiddleware remembers the last
+// sequence number for a key that hasn't sent any requests.
+const sequenceIdleTimeout = time.Hour
+
+type sequenceEntry struct {
+	seq      uint64
+	lastSeen time.Time
+}
+
+// sequenceTracker records the last sequence number accepted for each key.
+// Keys that are idle for longer than idle are swept out as new requests
+// arrive.
+type sequenceTracker struct {
+	mu        sync.Mutex
+	idle      time.Duration
+	last      map[string]sequenceEntry
+	lastSweep time.Time
+}
+
+func newSequenceTracker(idle time.Duration) *sequenceTracker {
+	return &sequenceTracker{idle: idle, last: make(map[string]sequenceEntry), lastSweep: time.Now()}
+}
+
+// advance records seq as the last sequence number for key, if it's greater
+// than the current one. It returns the previous sequence number and whether
+// seq was accepted.
+func (t *sequenceTracker) advance(key string, seq uint64, now time.Time) (uint64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.lastSweep) > t.idle {
+		for k, entry := range t.last {
+			if now.Sub(entry.lastSeen) > t.idle {
+				delete(t.last, k)
+			}
+		}
+		t.lastSweep = now
+	}
+	entry, ok := t.last[key]
+	if ok && now.Sub(entry.lastSeen) <= t.idle && seq <= entry.seq {
+		return entry.seq, false
+	}
+	t.last[key] = sequenceEntry{seq: seq, lastSeen: now}
+	return entry.seq, true
+}
+
+// SequenceMiddleware rejects requests that arrive out of order. Clients
+// number their requests with an increasing integer in the X-Sequence header;
+// a request whose sequence number is not greater than the last one accepted
+// for the same key gets a 409 error. keyFn identifies the stream of
+// requests, for example the client ID; requests for which it returns the
+// empty string, or without an X-Sequence header, are not checked.
+//
+// A request's sequence number is recorded before h is called, so a request
+// that h fails can't be retried with the same number. Keys are forgotten
+// after an hour without requests, after which any sequence number is
+// accepted. The sequence numbers are kept in memory, so they aren't shared
+// between servers.
+func SequenceMiddleware(h http.Handler, keyFn func(*http.Request) string) http.Handler {
+	tracker := newSequenceTracker(sequenceIdleTimeout)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hdr := strings.TrimSpace(r.Header.Get(SequenceHeader))
+		if hdr == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := keyFn(r)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		seq, err := strconv.ParseUint(hdr, 10, 64)
+		if err != nil {
+			WriteError(w, &Error{
+				Title:      "Invalid header",
+				Id:         "invalid_header",
+				Detail:     fmt.Sprintf("The %s header must be a non-negative integer", SequenceHeader),
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		if last, ok := tracker.advance(key, seq, time.Now()); !ok {
+			WriteError(w, &Error{
+				Title:      "Request out of order",
+				Id:         "out_of_order",
+				Detail:     fmt.Sprintf("Sequence number %d is not greater than the last one received, %d", seq, last),
+				Instance:   r.URL.Path,
+				StatusCode: http.StatusConflict,
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestSequenceMiddleware(t *testing.T) {
+	h := SequenceMiddleware(okHandler, func(r *http.Request) string {
+		return r.Header.Get("X-Client-Id")
+	})
+	for _, tt := range []struct {
+		client string
+		seq    string
+		code   int
+	}{
+		{"a", "1", 200},
+		{"a", "2", 200},
+		{"a", "2", 409},
+		{"a", "1", 409},
+		{"b", "1", 200},
+		{"a", "5", 200},
+		{"a", "", 200},
+		{"", "1", 200},
+		{"a", "abc", 400},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/sync", nil)
+		req.Header.Set("X-Client-Id", tt.client)
+		req.Header.Set(SequenceHeader, tt.seq)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, tt.code)
+		if tt.code == 409 {
+			test.AssertContains(t, w.Body.String(), "out_of_order")
+		}
+	}
+}
+
+func TestSequenceTrackerEviction(t *testing.T) {
+	tr := newSequenceTracker(time.Minute)
+	now := time.Now()
+	_, ok := tr.advance("a", 5, now)
+	test.Assert(t, ok, "expected first sequence to be accepted")
+	_, ok = tr.advance("a", 3, now.Add(time.Second))
+	test.Assert(t, !ok, "expected lower sequence to be rejected")
+	_, ok = tr.advance("b", 1, now.Add(2*time.Minute))
+	test.Assert(t, ok, "expected sequence to be accepted")
+	test.AssertEquals(t, len(tr.last), 1)
+	_, ok = tr.advance("a", 3, now.Add(2*time.Minute))
+	test.Assert(t, ok, "expected idle key to be forgotten")
+}
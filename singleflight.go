@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+// DefaultSingleFlightMaxBytes is the largest response body
+// SingleFlightMiddleware buffers to share with waiting requests.
+const DefaultSingleFlightMaxBytes = 1 << 20
+
+// sharedResponse is a copy of a response written by the handler, which can
+// be replayed to other requests for the same key.
+type sharedResponse struct {
+	status    int
+	header    http.Header
+	body      bytes.Buffer
+	truncated bool
+}
+
+// teeWriter writes through to the underlying ResponseWriter, while keeping a
+// copy of the response (up to maxBytes of body) in resp. Create one with
+// newTeeWriter.
+type teeWriter struct {
+	http.ResponseWriter
+	resp        *sharedResponse
+	maxBytes    int
+	outer       []string
+	wroteHeader bool
+}
+
+// newTeeWriter returns a teeWriter for w. Headers already set on w belong to
+// this request, like X-Request-Id set by an outer middleware, so they're
+// left out of the copy.
+func newTeeWriter(w http.ResponseWriter, resp *sharedResponse, maxBytes int) *teeWriter {
+	outer := make([]string, 0, len(w.Header()))
+	for k := range w.Header() {
+		outer = append(outer, k)
+	}
+	return &teeWriter{ResponseWriter: w, resp: resp, maxBytes: maxBytes, outer: outer}
+}
+
+func (w *teeWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.resp.status = code
+	w.resp.header = cloneHeader(w.Header())
+	for _, k := range w.outer {
+		delete(w.resp.header, k)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.resp.truncated {
+		if w.resp.body.Len()+len(b) > w.maxBytes {
+			w.resp.truncated = true
+			w.resp.body.Reset()
+		} else {
+			w.resp.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, v := range h {
+		v2 := make([]string, len(v))
+		copy(v2, v)
+		h2[k] = v2
+	}
+	return h2
+}
+
+// copyNewHeaders copies the headers in src to dst, except for headers that
+// are already set in dst. The values are copied, so later changes to dst
+// don't change src.
+func copyNewHeaders(dst, src http.Header) {
+	for k, v := range src {
+		if _, ok := dst[k]; !ok {
+			dst[k] = append([]string(nil), v...)
+		}
+	}
+}
+
+// flightCall is a call to the handler that other requests for the same key
+// are waiting on. resp is nil if the handler panicked.
+type flightCall struct {
+	done chan struct{}
+	resp *sharedResponse
+}
+
+// flightGroup tracks the in-flight calls for SingleFlightMiddleware.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do calls fn for key, unless a call for key is already in flight, in which
+// case it waits for that call and returns its response. leader is true if
+// fn was called.
+func (g *flightGroup) do(key string, fn func() *sharedResponse) (resp *sharedResponse, leader bool) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.resp, false
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.resp = fn()
+	return c.resp, true
+}
+
+// SingleFlightMiddleware coalesces concurrent GET and HEAD requests that
+// share a key. The first request for a key runs h; requests for the same key
+// that arrive while it's running wait for it to finish, and receive a copy of
+// its status, headers and body instead of running h themselves. Only the
+// headers h sets are shared; headers set by middleware outside
+// SingleFlightMiddleware, like X-Request-Id, keep each request's own values.
+//
+// keyFn should return the same key for requests that can share a response,
+// for example the method and the URL. Requests for which keyFn returns the
+// empty string, and requests with any other method, are passed straight
+// through to h.
+//
+// Response bodies over DefaultSingleFlightMaxBytes are not buffered; if the
+// shared response is larger than that, or h panics, each waiting request
+// runs h on its own.
+func SingleFlightMiddleware(h http.Handler, keyFn func(*http.Request) string) http.Handler {
+	return SingleFlightMiddlewareWithMaxBytes(h, keyFn, DefaultSingleFlightMaxBytes)
+}
+
+// SingleFlightMiddlewareWithMaxBytes is like SingleFlightMiddleware, but
+// shares response bodies up to maxBytes long.
+func SingleFlightMiddlewareWithMaxBytes(h http.Handler, keyFn func(*http.Request) string, maxBytes int) http.Handler {
+	group := &flightGroup{calls: make(map[string]*flightCall)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := keyFn(r)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		resp, leader := group.do(key, func() *sharedResponse {
+			resp := new(sharedResponse)
+			tw := newTeeWriter(w, resp, maxBytes)
+			h.ServeHTTP(tw, r)
+			if !tw.wroteHeader {
+				tw.WriteHeader(http.StatusOK)
+			}
+			return resp
+		})
+		if leader {
+			return
+		}
+		if resp == nil || resp.truncated {
+			h.ServeHTTP(w, r)
+			return
+		}
+		copyNewHeaders(w.Header(), resp.header)
+		w.WriteHeader(resp.status)
+		w.Write(resp.body.Bytes())
+	})
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestSingleFlightCoalescesRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := SingleFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("X-Result", "shared")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello"))
+	}), func(r *http.Request) string {
+		return r.URL.Path
+	})
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 5)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+			h.ServeHTTP(w, req)
+		}(recorders[i])
+	}
+	// Give the goroutines a chance to join the in-flight call.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	test.AssertEquals(t, atomic.LoadInt32(&calls), int32(1))
+	for _, w := range recorders {
+		test.AssertEquals(t, w.Code, http.StatusAccepted)
+		test.AssertEquals(t, w.Header().Get("X-Result"), "shared")
+		test.AssertEquals(t, w.Body.String(), "hello")
+	}
+}
+
+func TestSingleFlightSkipsPost(t *testing.T) {
+	var calls int32
+	h := SingleFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}), func(r *http.Request) string {
+		t.Fatal("keyFn should not be called for POST requests")
+		return ""
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/jobs", nil)
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, atomic.LoadInt32(&calls), int32(1))
+}
+
+func TestSingleFlightKeepsPerRequestHeaders(t *testing.T) {
+	release := make(chan struct{})
+	inner := SingleFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("X-Result", "shared")
+		w.Write([]byte("hello"))
+	}), func(r *http.Request) string {
+		return r.URL.Path
+	})
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: RequestID(r)})
+		inner.ServeHTTP(w, r)
+	}))
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 3)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+			h.ServeHTTP(w, req)
+		}(recorders[i])
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, w := range recorders {
+		test.AssertEquals(t, w.Body.String(), "hello")
+		test.AssertDeepEquals(t, w.Header().Values("X-Result"), []string{"shared"})
+		ids := w.Header().Values(RequestIDHeader)
+		test.AssertEquals(t, len(ids), 1)
+		test.Assert(t, !seen[ids[0]], "expected each request to keep its own request ID")
+		seen[ids[0]] = true
+		test.AssertDeepEquals(t, w.Header().Values("Set-Cookie"), []string{"session=" + ids[0]})
+	}
+}
+
+func TestSingleFlightMaxBytes(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := SingleFlightMiddlewareWithMaxBytes(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+		}
+		w.Write([]byte("hello"))
+	}), func(r *http.Request) string {
+		return r.URL.Path
+	}, 4)
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 3)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+			h.ServeHTTP(w, req)
+		}(recorders[i])
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// The body is too large to share, so every request runs the handler.
+	test.AssertEquals(t, atomic.LoadInt32(&calls), int32(3))
+	for _, w := range recorders {
+		test.AssertEquals(t, w.Body.String(), "hello")
+	}
+}
+
+func TestSingleFlightLeaderPanics(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := SingleFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			panic("boom")
+		}
+		w.Write([]byte("hello"))
+	}), func(r *http.Request) string {
+		return r.URL.Path
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() { recover() }()
+		req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, _ := http.NewRequest("GET", "/v1/jobs", nil)
+		h.ServeHTTP(w, req)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-done
+	wg.Wait()
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	test.AssertEquals(t, w.Body.String(), "hello")
+}
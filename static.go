@@ -0,0 +1,49 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// PrecompressedFileServer serves the files in dir, like http.FileServer.
+// If the client accepts gzip and there's a file with the same name plus a
+// ".gz" extension next to the requested one, for example app.js.gz next to
+// app.js, the compressed file is served as-is with "Content-Encoding: gzip",
+// so assets can be compressed once at build time. Otherwise the requested
+// file is served, gzipped on the fly for clients that accept it.
+//
+// The Content-Type is set from the extension of the requested file, not the
+// ".gz" file, and responses always vary on Accept-Encoding.
+func PrecompressedFileServer(dir string) http.Handler {
+	root := http.Dir(dir)
+	files := http.FileServer(root)
+	gzipped := GzipMiddleware(files)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			files.ServeHTTP(w, r)
+			return
+		}
+		name := path.Clean("/" + r.URL.Path)
+		if !strings.HasSuffix(name, "/") && path.Ext(name) != ".gz" {
+			if f, err := root.Open(name + ".gz"); err == nil {
+				defer f.Close()
+				if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+					h := w.Header()
+					h.Add("Vary", "Accept-Encoding")
+					h.Set("Content-Encoding", "gzip")
+					if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+						h.Set("Content-Type", ctype)
+					} else {
+						h.Set("Content-Type", "application/octet-stream")
+					}
+					http.ServeContent(w, r, name, fi.ModTime(), f)
+					return
+				}
+			}
+		}
+		gzipped.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func writeGzipFile(t *testing.T, name, content string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(content))
+	gz.Close()
+	test.AssertNotError(t, os.WriteFile(name, buf.Bytes(), 0644), "")
+}
+
+func TestPrecompressedFileServer(t *testing.T) {
+	dir := t.TempDir()
+	test.AssertNotError(t, os.WriteFile(filepath.Join(dir, "app.js"), []byte("uncompressed"), 0644), "")
+	writeGzipFile(t, filepath.Join(dir, "app.js.gz"), "precompressed")
+	test.AssertNotError(t, os.WriteFile(filepath.Join(dir, "style.css"), []byte("body{}"), 0644), "")
+	h := PrecompressedFileServer(dir)
+
+	for _, tt := range []struct {
+		path     string
+		encoding string
+		body     string
+		ctype    string
+	}{
+		{"/app.js", "gzip", "precompressed", "text/javascript; charset=utf-8"},
+		{"/app.js", "", "uncompressed", "text/javascript; charset=utf-8"},
+		{"/style.css", "gzip", "body{}", "text/css; charset=utf-8"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.encoding)
+		h.ServeHTTP(w, req)
+		test.AssertEquals(t, w.Code, http.StatusOK)
+		test.AssertEquals(t, w.Header().Get("Vary"), "Accept-Encoding")
+		test.AssertEquals(t, w.Header().Get("Content-Encoding"), tt.encoding)
+		test.AssertEquals(t, w.Header().Get("Content-Type"), tt.ctype)
+		var body io.Reader = w.Body
+		if tt.encoding == "gzip" {
+			gz, err := gzip.NewReader(w.Body)
+			test.AssertNotError(t, err, "")
+			body = gz
+		}
+		b, err := io.ReadAll(body)
+		test.AssertNotError(t, err, "")
+		test.AssertEquals(t, string(b), tt.body)
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import "net/http"
+
+// StatusRecorder is a http.ResponseWriter that records the status code
+// written by a handler, so middleware can inspect it after the handler
+// returns.
+type StatusRecorder struct {
+	http.ResponseWriter
+	// Status is the status code written to the client, or 0 if the handler
+	// hasn't written anything yet.
+	Status int
+}
+
+// NewStatusRecorder returns a StatusRecorder that writes through to w.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w}
+}
+
+func (s *StatusRecorder) WriteHeader(code int) {
+	if s.Status == 0 {
+		s.Status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *StatusRecorder) Write(b []byte) (int, error) {
+	if s.Status == 0 {
+		s.Status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client, if the underlying
+// ResponseWriter supports it.
+func (s *StatusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for use with
+// http.ResponseController.
+func (s *StatusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// OnErrorMiddleware calls fn with the request and response status after h
+// returns, if h responded with a server error (a status of 500 or above).
+// Use it to alert or record metrics on failures without parsing logs.
+func OnErrorMiddleware(h http.Handler, fn func(r *http.Request, status int)) http.Handler {
+	return OnErrorMiddlewareWithThreshold(h, http.StatusInternalServerError, fn)
+}
+
+// OnErrorMiddlewareWithThreshold is like OnErrorMiddleware, but calls fn for
+// any status of threshold or above, for example 400 to include client
+// errors.
+func OnErrorMiddlewareWithThreshold(h http.Handler, threshold int, fn func(r *http.Request, status int)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := NewStatusRecorder(w)
+		h.ServeHTTP(rec, r)
+		status := rec.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= threshold {
+			fn(r, status)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	rec := NewStatusRecorder(httptest.NewRecorder())
+	rec.Write([]byte("hello"))
+	rec.WriteHeader(http.StatusInternalServerError)
+	test.AssertEquals(t, rec.Status, http.StatusOK)
+}
+
+func TestOnErrorMiddleware(t *testing.T) {
+	var statuses []int
+	fn := func(r *http.Request, status int) {
+		statuses = append(statuses, status)
+	}
+	for _, code := range []int{200, 404, 500, 503} {
+		code := code
+		h := OnErrorMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}), fn)
+		req, _ := http.NewRequest("GET", "/", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	test.AssertDeepEquals(t, statuses, []int{500, 503})
+
+	statuses = nil
+	h := OnErrorMiddlewareWithThreshold(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}), 400, fn)
+	req, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertDeepEquals(t, statuses, []int{404})
+}
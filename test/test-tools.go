@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"net/http/httptest"
 	"reflect"
 	"runtime"
 	"strings"
@@ -141,3 +142,31 @@ func AssertBetween(t *testing.T, a, b, c int64) {
 		t.Fatalf("%d is not between %d and %d", a, b, c)
 	}
 }
+
+// AssertErrorResponse checks that w holds a JSON error response with the
+// given status code and id, as written by server.WriteError. The name
+// AssertError is taken by the helper for Go errors.
+func AssertErrorResponse(t *testing.T, w *httptest.ResponseRecorder, wantStatus int, wantId string) {
+	body := w.Body.String()
+	if w.Code != wantStatus {
+		t.Fatalf("%s Status [%d] != [%d], body: %s", caller(), w.Code, wantStatus, body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("%s Content-Type [%s] is not JSON, body: %s", caller(), ct, body)
+	}
+	// Decode into a copy of the fields we need, since this package can't
+	// import the server package.
+	var e struct {
+		Id         string `json:"id"`
+		StatusCode int    `json:"status_code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatalf("%s Could not decode error: %s, body: %s", caller(), err, body)
+	}
+	if e.Id != wantId {
+		t.Fatalf("%s Error id [%s] != [%s], body: %s", caller(), e.Id, wantId, body)
+	}
+	if e.StatusCode != wantStatus {
+		t.Fatalf("%s Error status_code [%d] != [%d], body: %s", caller(), e.StatusCode, wantStatus, body)
+	}
+}
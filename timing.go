@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type timing struct {
+	name string
+	dur  time.Duration
+}
+
+type timings struct {
+	mu      sync.Mutex
+	entries []timing
+}
+
+func (t *timings) add(name string, dur time.Duration) {
+	t.mu.Lock()
+	t.entries = append(t.entries, timing{name: name, dur: dur})
+	t.mu.Unlock()
+}
+
+// header returns the Server-Timing header value for the recorded timings,
+// followed by total.
+func (t *timings) header(total time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.entries)+1)
+	for _, e := range t.entries {
+		parts = append(parts, formatTiming(e.name, e.dur))
+	}
+	parts = append(parts, formatTiming("total", total))
+	return strings.Join(parts, ", ")
+}
+
+func formatTiming(name string, dur time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(dur)/float64(time.Millisecond))
+}
+
+// AddTiming records a sub-timing for the request, which will be included in
+// the Server-Timing header written by ServerTimingMiddleware. Timings must be
+// recorded before the handler writes the response status or body. AddTiming
+// is a no-op if the request is not being served by ServerTimingMiddleware.
+func AddTiming(r *http.Request, name string, dur time.Duration) {
+	if t, ok := r.Context().Value(timingsKey).(*timings); ok {
+		t.add(name, dur)
+	}
+}
+
+// timingWriter adds a Server-Timing header, computed by header, just before
+// the response starts.
+type timingWriter struct {
+	http.ResponseWriter
+	header      func() string
+	wroteHeader bool
+}
+
+func (w *timingWriter) setHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if v := w.header(); v != "" {
+		w.Header().Add("Server-Timing", v)
+	}
+}
+
+func (w *timingWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timingWriter) Flush() {
+	w.setHeader()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ServerTimingMiddleware adds a Server-Timing header to the response, with
+// the time spent in h as the "total" metric, plus any timings recorded with
+// AddTiming.
+//
+// The header is set when the handler first writes the status or the body,
+// since headers can't be changed after that point, so "total" measures the
+// time until the response starts, not until it completes.
+func ServerTimingMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := new(timings)
+		start := time.Now()
+		tw := &timingWriter{ResponseWriter: w, header: func() string {
+			return t.header(time.Since(start))
+		}}
+		r = r.WithContext(context.WithValue(r.Context(), timingsKey, t))
+		h.ServeHTTP(tw, r)
+		tw.setHeader()
+	})
+}
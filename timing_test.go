@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestServerTiming(t *testing.T) {
+	h := ServerTimingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddTiming(r, "db", 5*time.Millisecond)
+		w.Write([]byte("hello"))
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1", nil)
+	h.ServeHTTP(w, req)
+	header := w.Header().Get("Server-Timing")
+	test.Assert(t, strings.HasPrefix(header, "db;dur=5.000, total;dur="), header)
+}
+
+func TestServerTimingNoBody(t *testing.T) {
+	h := ServerTimingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1", nil)
+	h.ServeHTTP(w, req)
+	test.AssertContains(t, w.Header().Get("Server-Timing"), "total;dur=")
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// MinTLSMiddleware returns a 403 error for requests made over a TLS version
+// older than min, for example tls.VersionTLS12, and for requests that weren't
+// made over TLS at all. It enforces the policy even if the listener's
+// tls.Config allows older versions.
+func MinTLSMiddleware(h http.Handler, min uint16) http.Handler {
+	return minTLSMiddleware(h, min, false)
+}
+
+// MinTLSOrPlaintextMiddleware is like MinTLSMiddleware, but passes through
+// requests that weren't made over TLS, for servers that also listen for plain
+// HTTP (for example behind a load balancer that terminates TLS).
+func MinTLSOrPlaintextMiddleware(h http.Handler, min uint16) http.Handler {
+	return minTLSMiddleware(h, min, true)
+}
+
+func minTLSMiddleware(h http.Handler, min uint16, allowPlaintext bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			if allowPlaintext {
+				h.ServeHTTP(w, r)
+				return
+			}
+			WriteError(w, newTLSTooLow(r, fmt.Sprintf("Requests must be made over %s or newer", tls.VersionName(min))))
+			return
+		}
+		if r.TLS.Version < min {
+			WriteError(w, newTLSTooLow(r, fmt.Sprintf("Requests must be made over %s or newer, not %s", tls.VersionName(min), tls.VersionName(r.TLS.Version))))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newTLSTooLow(r *http.Request, detail string) *Error {
+	return &Error{
+		Title:      "TLS version too low",
+		Id:         "tls_version_too_low",
+		Detail:     detail,
+		Instance:   r.URL.Path,
+		StatusCode: http.StatusForbidden,
+	}
+}
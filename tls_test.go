@@ -0,0 +1,38 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shyp/go-servers/test"
+)
+
+func TestMinTLS(t *testing.T) {
+	h := MinTLSMiddleware(okHandler, tls.VersionTLS12)
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusForbidden)
+
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS11}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusForbidden)
+	test.AssertContains(t, w.Body.String(), "tls_version_too_low")
+	test.AssertContains(t, w.Body.String(), "TLS 1.1")
+
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}
+
+func TestMinTLSOrPlaintext(t *testing.T) {
+	h := MinTLSOrPlaintextMiddleware(okHandler, tls.VersionTLS12)
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	test.AssertEquals(t, w.Code, http.StatusOK)
+}